@@ -1,9 +1,13 @@
 package buffer
 
 import (
-	"errors"
+	"bufio"
+	"bytes"
+	"context"
 	"io"
+	"path/filepath"
 	"sync"
+	"time"
 
 	"github.com/spf13/afero"
 )
@@ -11,13 +15,71 @@ import (
 // Bucket represents a single data sink.
 type Bucket struct {
 	sync.RWMutex
-	path   string
-	fs     afero.Fs
-	file   afero.File
-	open   bool
-	writer io.Writer
-	writes uint
-	bytes  uint64
+	// these are only set when the bucket belongs to a buffer
+	key  string
+	name []string
+	// when the time window for this bucket ends, guarded by the buffer lock
+	window time.Time
+	events *events
+
+	path        string
+	fs          afero.Fs
+	file        afero.File
+	open        bool
+	framed      bool
+	checksum    bool
+	compression string
+	keys        KeyProvider
+	format      Format
+	header      []string
+	writer      io.Writer
+	closers     []io.Closer
+	buffered    *bufio.Writer
+	reader      *bufio.Reader
+	records     *recordReader
+	writes      uint
+	bytes       uint64
+	disk        uint64
+	// set when writes from before recovery could not be counted
+	uncounted bool
+
+	// the current section of an encrypted file and how many it has so far
+	encrypter *encryptWriter
+	sections  uint32
+
+	syncPolicy   SyncPolicy
+	syncWrites   uint
+	syncInterval time.Duration
+	unsynced     uint
+	syncErr      error
+	stop         chan struct{}
+	// starts the tickers for background syncs and flushes
+	ticker func(time.Duration) (<-chan time.Time, func())
+
+	writeBuffer   int
+	flushInterval time.Duration
+
+	maxSegmentBytes  uint64
+	maxSegmentWrites uint
+	segment          int
+	segmentWrites    uint
+	segmentBytes     uint64
+
+	// closed whenever there is something new for followers to read
+	changed chan struct{}
+
+	// set when the bucket belongs to a buffer that limits open files
+	handles   *handles
+	suspended bool
+	// how much has been read, and the segments being read when segmented, so
+	// reading can carry on after the file is suspended
+	consumed int64
+	segments *multiSegmentReader
+
+	// holds what is written until it grows past spillBytes, when set
+	memory     *bytes.Buffer
+	spillBytes uint64
+	ceiling    *ceiling
 }
 
 // NewBucket creates a new bucket instance with the given options.
@@ -25,93 +87,417 @@ func NewBucket(o BucketOptions) *Bucket {
 	o.defaults()
 
 	return &Bucket{
-		path: o.Path,
-		fs:   o.Fs,
+		path:        o.Path,
+		fs:          o.Fs,
+		framed:      o.Framed || o.Checksum,
+		checksum:    o.Checksum,
+		compression: o.Compression,
+		keys:        o.Encryption,
+		format:      o.Format,
+		header:      o.Header,
+
+		syncPolicy:   o.Sync,
+		syncWrites:   o.SyncWrites,
+		syncInterval: o.SyncInterval,
+		ticker:       newTicker,
+
+		writeBuffer:   o.WriteBuffer,
+		flushInterval: o.FlushInterval,
+
+		maxSegmentBytes:  o.MaxSegmentBytes,
+		maxSegmentWrites: o.MaxSegmentWrites,
+
+		spillBytes: o.SpillBytes,
 	}
 }
 
 // Open is the primary interface for initializing the bucket on disk and setting
 // up for writes.
-func (b *Bucket) Open() error {
+func (b *Bucket) Open() (err error) {
 	b.Lock()
 	defer b.Unlock()
+	defer b.wrap("open", &err)
 
 	if b.open {
-		return errors.New("bucket already open")
+		return ErrBucketOpen
+	}
+	if err := b.checkCSV(); err != nil {
+		return err
 	}
 
-	if err := b.create(); err != nil {
+	b.uncounted = false
+	if b.spillBytes > 0 {
+		if err := b.hold(); err != nil {
+			return err
+		}
+	} else if err := b.create(); err != nil {
 		return err
 	}
 
 	b.open = true
+	b.background()
 
-	return nil
+	return b.acquire()
 }
 
 // Close flushes everything in memory to disk, converts the bucket to stop
 // accepting new writes and seeks the file pointer back to the beginning in
 // preparation for reading. (as such, it must be called before being read from)
-func (b *Bucket) Close() error {
+// Unless the sync policy is SyncNone, the file is also synced.
+func (b *Bucket) Close() (err error) {
 	b.Lock()
 	defer b.Unlock()
+	defer b.wrap("close", &err)
+
+	if !b.started() {
+		return ErrBucketNotOpen
+	}
+	if err := b.acquire(); err != nil {
+		return err
+	}
+
+	if b.open {
+		b.halt()
+
+		if err := b.syncErr; err != nil {
+			b.syncErr = nil
+			return err
+		}
+
+		if err := b.end(); err != nil {
+			return err
+		}
+		if err := b.finish(); err != nil {
+			return err
+		}
+
+		b.events.emit(b.event(EventSealed))
+	}
 
 	b.open = false
-	if _, err := b.file.Seek(0, 0); err != nil {
+	b.notify()
+
+	return b.rewind()
+}
+
+// Reopen starts accepting writes again after Close, appending to what is
+// already on disk rather than starting over like Open would. The Writes and
+// Bytes counters carry on from where they were.
+func (b *Bucket) Reopen() (err error) {
+	b.Lock()
+	defer b.Unlock()
+	defer b.wrap("reopen", &err)
+
+	if b.open {
+		return ErrBucketOpen
+	}
+	if !b.started() {
+		return ErrBucketNotOpen
+	}
+	if err := b.acquire(); err != nil {
 		return err
 	}
 
+	// encoded files get a new stream after the existing one
+	if b.memory == nil {
+		if _, err := b.file.Seek(0, io.SeekEnd); err != nil {
+			return err
+		}
+		if b.keys != nil {
+			if err := b.unseal(); err != nil {
+				return err
+			}
+		}
+		if err := b.encode(b.file); err != nil {
+			return err
+		}
+	}
+
+	b.reader = nil
+	b.records = nil
+	b.open = true
+	b.background()
+
+	b.events.emit(b.event(EventReopened))
+
 	return nil
 }
 
+// finish closes the chain of writers for the current file, so that everything
+// has been written out, and syncs the file according to the policy.
+func (b *Bucket) finish() error {
+	for _, closer := range b.closers {
+		if err := closer.Close(); err != nil {
+			return err
+		}
+	}
+	b.closers = nil
+	b.buffered = nil
+
+	if b.syncPolicy != SyncNone && b.file != nil {
+		if err := b.file.Sync(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rewind prepares to read the bucket from the beginning.
+func (b *Bucket) rewind() error {
+	var reader io.Reader
+	if b.memory != nil {
+		reader = bytes.NewReader(b.memory.Bytes())
+	} else if b.segmented() {
+		b.segments = b.segmentReader()
+		reader = b.segments
+	} else {
+		if _, err := b.file.Seek(0, 0); err != nil {
+			return err
+		}
+		decoded, err := b.decode(b.file)
+		if err != nil {
+			return err
+		}
+		reader = decoded
+	}
+
+	b.reader = bufio.NewReader(reader)
+	b.records = &recordReader{r: readerFunc(b.consume), checksum: b.checksum}
+	b.consumed = 0
+
+	return nil
+}
+
+// consume reads from the bucket, keeping track of how far it has got so that
+// the position can be restored if the file is closed in the meantime.
+func (b *Bucket) consume(p []byte) (int, error) {
+	n, err := b.reader.Read(p)
+	b.consumed += int64(n)
+	return n, err
+}
+
 func (b *Bucket) create() error {
-	file, err := b.fs.Create(b.path)
+	// positions for any consumers are meaningless for a new file
+	if err := b.fs.RemoveAll(b.offsetsPath()); err != nil {
+		return err
+	}
+
+	b.segment = 0
+	b.segmentWrites = 0
+	b.segmentBytes = 0
+
+	path := b.path
+	if b.segmented() {
+		if err := b.fs.RemoveAll(b.path); err != nil {
+			return err
+		}
+		if err := b.fs.MkdirAll(b.path, 0755); err != nil {
+			return err
+		}
+		path = b.segmentPath(0)
+	}
+
+	if err := b.fs.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	file, err := b.fs.Create(path)
 	if err != nil {
 		return err
 	}
 
 	b.file = file
+	b.sections = 0
+
+	return b.encode(file)
+}
+
+// encode sets up the chain of writers that data passes through on the way to
+// the given file.
+func (b *Bucket) encode(file io.Writer) error {
+	b.writer = &countingWriter{w: file, count: &b.disk}
+
+	if b.writeBuffer > 0 {
+		b.buffered = bufio.NewWriterSize(b.writer, b.writeBuffer)
+		b.writer = b.buffered
+		b.closers = append([]io.Closer{flushCloser{b.buffered}}, b.closers...)
+	}
+
+	if b.keys != nil {
+		writer, err := newEncryptWriter(b.writer, b.keys, b.sections)
+		if err != nil {
+			return err
+		}
+		b.encrypter = writer
+		b.sections++
+		b.writer = writer
+		b.closers = append([]io.Closer{writer}, b.closers...)
+	}
+
+	if b.compression != "" {
+		compressor, err := lookupCompressor(b.compression)
+		if err != nil {
+			return err
+		}
+		writer, err := compressor.NewWriter(b.writer)
+		if err != nil {
+			return err
+		}
+		b.writer = writer
+		b.closers = append([]io.Closer{writer}, b.closers...)
+	}
 
 	return nil
 }
 
-// Destroy removes the file from disk.
-func (b *Bucket) Destroy() error {
+// decode wraps the given file with the readers needed to undo encode.
+func (b *Bucket) decode(file io.Reader) (io.Reader, error) {
+	var reader io.Reader = bufio.NewReader(file)
+
+	if b.keys != nil {
+		reader = newDecryptReader(reader, b.keys)
+	}
+
+	if b.compression != "" {
+		compressor, err := lookupCompressor(b.compression)
+		if err != nil {
+			return nil, err
+		}
+		return &multistream{r: bufio.NewReader(reader), compressor: compressor}, nil
+	}
+
+	return reader, nil
+}
+
+// Destroy removes the file (or all the segments) from disk.
+func (b *Bucket) Destroy() (err error) {
 	b.Lock()
 	defer b.Unlock()
+	defer b.wrap("destroy", &err)
+
+	b.halt()
+
+	if b.file != nil {
+		b.file.Close()
+		b.file = nil
+	}
+	b.handles.remove(b)
+	b.suspended = false
+	b.open = false
+	b.notify()
 
-	if err := b.fs.Remove(b.file.Name()); err != nil {
+	if b.memory != nil {
+		b.memory = nil
+		b.ceiling.remove(b)
+	} else if b.segmented() {
+		if err := b.fs.RemoveAll(b.path); err != nil {
+			return err
+		}
+	} else if err := b.fs.Remove(b.path); err != nil {
+		return err
+	}
+	if err := b.fs.RemoveAll(b.offsetsPath()); err != nil {
 		return err
 	}
 
+	b.events.emit(b.event(EventDestroyed))
+
 	b.writes = 0
 	b.bytes = 0
+	b.disk = 0
+	b.uncounted = false
 
 	return nil
 }
 
-// Write adds the given data to this bucket.
+// Write adds the given data to this bucket. The chunks are joined together
+// before being checked against the Format.
 func (b *Bucket) Write(data ...[]byte) error {
-	b.Lock()
-	defer b.Unlock()
+	return b.WriteContext(context.Background(), data...)
+}
 
+// append does the work for Write, the caller must hold the lock. It returns
+// how many bytes of the data were written, even when it fails.
+func (b *Bucket) append(data [][]byte) (int, error) {
 	if !b.open {
-		return errors.New("bucket not accepting writes, make sure to open it first")
+		if b.started() {
+			return 0, ErrBucketSealed
+		}
+		return 0, ErrBucketNotOpen
+	}
+
+	if err := b.syncErr; err != nil {
+		b.syncErr = nil
+		return 0, err
+	}
+
+	if err := b.acquire(); err != nil {
+		return 0, err
+	}
+	if b.writer == nil {
+		// the previous stream was finished when the file was suspended
+		if err := b.encode(b.file); err != nil {
+			return 0, err
+		}
+	}
+
+	// even a failed write can leave something in the file
+	defer b.notify()
+
+	if b.memory == nil && b.full() {
+		if err := b.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	if b.format == FormatCSV && b.segmentBytes == 0 {
+		if err := b.writeHeader(); err != nil {
+			return 0, err
+		}
+	}
+
+	written, err := b.write(data)
+	b.bytes += uint64(written)
+	b.segmentBytes += uint64(written)
+	if err != nil {
+		return written, err
+	}
+	b.writes++
+	b.segmentWrites++
+
+	if err := b.held(); err != nil {
+		return written, err
+	}
+
+	return written, b.synced()
+}
+
+// write sends the data down the chain of writers, returning how many bytes of
+// it were written.
+func (b *Bucket) write(data [][]byte) (int, error) {
+	if b.framed {
+		return writeRecord(b.writer, data, b.checksum)
 	}
 
+	var written int
 	for _, chunk := range data {
-		bytes, err := b.file.Write(chunk)
-		b.bytes += uint64(bytes)
+		n, err := b.writer.Write(chunk)
+		written += n
 		if err != nil {
-			return err
+			return written, err
 		}
 	}
-	b.writes++
+	return written, nil
+}
 
-	return nil
+// Name retrieves the path of names used to get this bucket from its buffer,
+// which is empty for a bucket created on its own.
+func (b *Bucket) Name() []string {
+	return b.name
 }
 
-// Writes is used to retrieve the number of writes issued for this bucket.
+// Writes is used to retrieve the number of writes issued for this bucket. (see
+// WritesKnown for recovered buckets)
 func (b *Bucket) Writes() uint {
 	b.RLock()
 	defer b.RUnlock()
@@ -119,7 +505,19 @@ func (b *Bucket) Writes() uint {
 	return b.writes
 }
 
-// Bytes is used to retrieve the number of bytes written to this bucket.
+// WritesKnown reports whether Writes counts every write issued for this bucket,
+// which is not the case once a bucket that is not framed has been recovered
+// with existing data. Since record boundaries are not stored for it, only the
+// writes made since recovering are counted.
+func (b *Bucket) WritesKnown() bool {
+	b.RLock()
+	defer b.RUnlock()
+
+	return !b.uncounted
+}
+
+// Bytes is used to retrieve the number of bytes written to this bucket. This
+// counts the data as it was given to Write, before any compression.
 func (b *Bucket) Bytes() uint64 {
 	b.RLock()
 	defer b.RUnlock()
@@ -127,26 +525,148 @@ func (b *Bucket) Bytes() uint64 {
 	return b.bytes
 }
 
+// DiskBytes is used to retrieve the number of bytes this bucket has written to
+// the underlying file, after compression and including any record headers.
+func (b *Bucket) DiskBytes() uint64 {
+	b.RLock()
+	defer b.RUnlock()
+
+	return b.disk
+}
+
 // Read implements io.Reader for easy interoperability.
 func (b *Bucket) Read(p []byte) (int, error) {
+	b.Lock()
+	defer b.Unlock()
+
+	n, err := b.read(p)
+	return n, b.fail("read", err)
+}
+
+// read does the work for Read, the caller must hold the lock.
+func (b *Bucket) read(p []byte) (int, error) {
+	if b.open {
+		return 0, ErrBucketNotSealed
+	}
+	if err := b.acquire(); err != nil {
+		return 0, err
+	}
+
+	return b.consume(p)
+}
+
+// NextRecord retrieves the next record from a framed bucket, each record holds
+// the data from exactly one call to Write. When there are no more records,
+// io.EOF is returned. (like Read, the bucket must be closed first)
+//
+// When checksums are enabled, a damaged or truncated record is reported as a
+// *CorruptionError rather than returning bad data.
+func (b *Bucket) NextRecord() (record []byte, err error) {
+	b.Lock()
+	defer b.Unlock()
+	defer b.wrap("read", &err)
+
+	if !b.framed {
+		return nil, ErrNotFramed
+	}
+	if b.open {
+		return nil, ErrBucketNotSealed
+	}
+	if err := b.acquire(); err != nil {
+		return nil, err
+	}
+
+	return b.records.next()
+}
+
+// Verify scans every record in a framed bucket from the beginning, returning
+// a list of all the records that failed their integrity checks. (an empty list
+// means the bucket is intact) It uses a separate file handle, so it does not
+// interfere with Read or NextRecord.
+func (b *Bucket) Verify() (problems []*CorruptionError, err error) {
 	b.RLock()
 	defer b.RUnlock()
+	defer b.wrap("verify", &err)
 
+	if !b.framed {
+		return nil, ErrNotFramed
+	}
 	if b.open {
-		return 0, errors.New("bucket accepting writes, make sure to close before reading")
+		return nil, ErrBucketNotSealed
 	}
 
-	return b.file.Read(p)
+	reader, err := b.source()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	records := &recordReader{r: bufio.NewReader(reader), checksum: b.checksum}
+	for {
+		_, err := records.next()
+		if err == io.EOF {
+			return problems, nil
+		} else if err == io.ErrUnexpectedEOF {
+			return append(problems, records.corrupt(reasonTruncated)), nil
+		} else if corrupt, ok := err.(*CorruptionError); ok {
+			problems = append(problems, corrupt)
+		} else if err != nil {
+			return problems, err
+		}
+	}
 }
 
 // BucketOptions is used to configure bucket instances.
 type BucketOptions struct {
 	Path string
 	Fs   afero.Fs
+	// when enabled, each call to Write is stored as a single length-prefixed
+	// record that can be retrieved again using NextRecord
+	Framed bool
+	// adds a checksum to each record so corruption can be detected on read,
+	// this implies Framed
+	Checksum bool
+	// the name of a registered Compressor (eg: "gzip") that is used to
+	// transparently compress the file
+	Compression string
+	// when set, the file is encrypted with AES-GCM using keys from this
+	// provider, the ID of the key is stored in the file so keys can be rotated
+	Encryption KeyProvider
+	// determines how often the file is synced to disk (see SyncPolicy)
+	Sync SyncPolicy
+	// the number of writes between syncs for SyncEveryN (defaults to 100)
+	SyncWrites uint
+	// the time between syncs for SyncPeriodic (defaults to 1 second)
+	SyncInterval time.Duration
+	// when set, writes are collected in memory and only written to the file
+	// once this many bytes are waiting, which saves a syscall for every write
+	WriteBuffer int
+	// optionally flushes the WriteBuffer this often, even when it isn't full
+	FlushInterval time.Duration
+	// setting either of these splits the bucket into segments, Path becomes a
+	// directory holding a file for each segment and a new one is started as
+	// soon as the current one reaches either limit (bytes are counted before
+	// compression and a single write is never split across segments)
+	MaxSegmentBytes  uint64
+	MaxSegmentWrites uint
+	// how the data is laid out, which is checked on every write (see Format)
+	Format Format
+	// the names of the columns for FormatCSV
+	Header []string
+	// when set, Open does not create the file straight away and writes are
+	// held in memory until there are more than this many bytes, at which point
+	// they are spilled to the file (nothing is durable until then)
+	SpillBytes uint64
 }
 
 func (o *BucketOptions) defaults() {
 	if o.Fs == nil {
 		o.Fs = afero.NewOsFs()
 	}
+	if o.SyncWrites == 0 {
+		o.SyncWrites = 100
+	}
+	if o.SyncInterval == 0 {
+		o.SyncInterval = time.Second
+	}
 }
@@ -1,11 +1,16 @@
 package buffer
 
 import (
+	"errors"
 	"io"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -32,7 +37,7 @@ func (suite *BucketTestSuite) TestOpen() {
 
 func (suite *BucketTestSuite) TestOpenMultiple() {
 	suite.NoError(suite.bucket.Open())
-	suite.Error(suite.bucket.Open(), "bucket already open")
+	suite.True(errors.Is(suite.bucket.Open(), ErrBucketOpen))
 }
 
 func (suite *BucketTestSuite) TestClose() {
@@ -58,9 +63,53 @@ func (suite *BucketTestSuite) TestDestroy() {
 	suite.assertFileExists(false)
 }
 
+func (suite *BucketTestSuite) TestCloseDestroyed() {
+	suite.NoError(suite.bucket.Open())
+	suite.NoError(suite.bucket.Destroy())
+	suite.True(errors.Is(suite.bucket.Close(), ErrBucketNotOpen))
+}
+
+func (suite *BucketTestSuite) TestCloseUnopened() {
+	suite.True(errors.Is(suite.bucket.Close(), ErrBucketNotOpen))
+}
+
 func (suite *BucketTestSuite) TestWriteUnopened() {
 	data := []byte("hello world")
-	suite.Error(suite.bucket.Write(data), "bucket not accepting writes, make sure to open it first")
+	suite.True(errors.Is(suite.bucket.Write(data), ErrBucketNotOpen))
+}
+
+func (suite *BucketTestSuite) TestWriteSealed() {
+	suite.NoError(suite.bucket.Open())
+	suite.NoError(suite.bucket.Close())
+	suite.True(errors.Is(suite.bucket.Write([]byte("hello")), ErrBucketSealed))
+}
+
+func (suite *BucketTestSuite) TestReopen() {
+	suite.bucket.framed = true
+	suite.NoError(suite.bucket.Open())
+	suite.NoError(suite.bucket.Write([]byte("hello")))
+	suite.NoError(suite.bucket.Close())
+	suite.NoError(suite.bucket.Reopen())
+	suite.NoError(suite.bucket.Write([]byte("world")))
+	suite.EqualValues(2, suite.bucket.Writes())
+	suite.EqualValues(10, suite.bucket.Bytes())
+	suite.NoError(suite.bucket.Close())
+	for _, expected := range []string{"hello", "world"} {
+		record, err := suite.bucket.NextRecord()
+		suite.NoError(err)
+		suite.Equal(expected, string(record))
+	}
+	_, err := suite.bucket.NextRecord()
+	suite.Equal(io.EOF, err)
+}
+
+func (suite *BucketTestSuite) TestReopenStillOpen() {
+	suite.NoError(suite.bucket.Open())
+	suite.Error(suite.bucket.Reopen())
+}
+
+func (suite *BucketTestSuite) TestReopenUnopened() {
+	suite.Error(suite.bucket.Reopen())
 }
 
 func (suite *BucketTestSuite) TestWriteFlushed() {
@@ -103,7 +152,194 @@ func (suite *BucketTestSuite) TestRead() {
 func (suite *BucketTestSuite) TestReadStillOpen() {
 	suite.NoError(suite.bucket.Open())
 	_, err := ioutil.ReadAll(suite.bucket)
-	suite.Error(err, "bucket accepting writes, make sure to close before reading")
+	suite.True(errors.Is(err, ErrBucketNotSealed))
+}
+
+func (suite *BucketTestSuite) TestNextRecord() {
+	suite.bucket.framed = true
+	suite.NoError(suite.bucket.Open())
+	suite.NoError(suite.bucket.Write([]byte("hello"), []byte(" world")))
+	suite.NoError(suite.bucket.Write([]byte("second")))
+	suite.NoError(suite.bucket.Write())
+	suite.NoError(suite.bucket.Close())
+	for _, expected := range []string{"hello world", "second", ""} {
+		record, err := suite.bucket.NextRecord()
+		suite.NoError(err)
+		suite.Equal(expected, string(record))
+	}
+	_, err := suite.bucket.NextRecord()
+	suite.Equal(io.EOF, err)
+}
+
+func (suite *BucketTestSuite) TestNextRecordTruncated() {
+	suite.bucket.framed = true
+	suite.NoError(suite.bucket.Open())
+	suite.NoError(suite.bucket.Write([]byte("hello world")))
+	suite.NoError(suite.bucket.file.Truncate(8))
+	suite.NoError(suite.bucket.Close())
+	_, err := suite.bucket.NextRecord()
+	suite.True(errors.Is(err, io.ErrUnexpectedEOF))
+}
+
+func (suite *BucketTestSuite) TestNextRecordUnframed() {
+	suite.NoError(suite.bucket.Open())
+	suite.NoError(suite.bucket.Close())
+	_, err := suite.bucket.NextRecord()
+	suite.True(errors.Is(err, ErrNotFramed))
+}
+
+func (suite *BucketTestSuite) TestNextRecordStillOpen() {
+	suite.bucket.framed = true
+	suite.NoError(suite.bucket.Open())
+	_, err := suite.bucket.NextRecord()
+	suite.True(errors.Is(err, ErrBucketNotSealed))
+}
+
+func (suite *BucketTestSuite) TestFramedBytes() {
+	suite.bucket.framed = true
+	suite.NoError(suite.bucket.Open())
+	data := []byte("hello world\n")
+	suite.NoError(suite.bucket.Write(data))
+	suite.NoError(suite.bucket.Write(data))
+	suite.EqualValues(2*len(data), suite.bucket.Bytes())
+}
+
+func (suite *BucketTestSuite) TestChecksum() {
+	suite.bucket.framed = true
+	suite.bucket.checksum = true
+	suite.NoError(suite.bucket.Open())
+	suite.NoError(suite.bucket.Write([]byte("hello world")))
+	suite.NoError(suite.bucket.Close())
+	record, err := suite.bucket.NextRecord()
+	suite.NoError(err)
+	suite.Equal("hello world", string(record))
+	_, err = suite.bucket.NextRecord()
+	suite.Equal(io.EOF, err)
+}
+
+func (suite *BucketTestSuite) TestChecksumCorrupt() {
+	suite.bucket.framed = true
+	suite.bucket.checksum = true
+	suite.NoError(suite.bucket.Open())
+	suite.NoError(suite.bucket.Write([]byte("hello")))
+	suite.NoError(suite.bucket.Write([]byte("world")))
+	suite.NoError(suite.bucket.Write([]byte("again")))
+	_, err := suite.bucket.file.WriteAt([]byte("W"), 21)
+	suite.NoError(err)
+	suite.NoError(suite.bucket.Close())
+	record, err := suite.bucket.NextRecord()
+	suite.NoError(err)
+	suite.Equal("hello", string(record))
+	_, err = suite.bucket.NextRecord()
+	var corrupt *CorruptionError
+	suite.True(errors.As(err, &corrupt))
+	suite.Equal(&CorruptionError{Offset: 13, Record: 1, Reason: "checksum mismatch"}, corrupt)
+	record, err = suite.bucket.NextRecord()
+	suite.NoError(err)
+	suite.Equal("again", string(record))
+}
+
+func (suite *BucketTestSuite) TestChecksumTruncated() {
+	suite.bucket.framed = true
+	suite.bucket.checksum = true
+	suite.NoError(suite.bucket.Open())
+	suite.NoError(suite.bucket.Write([]byte("hello world")))
+	suite.NoError(suite.bucket.file.Truncate(12))
+	suite.NoError(suite.bucket.Close())
+	_, err := suite.bucket.NextRecord()
+	var corrupt *CorruptionError
+	suite.True(errors.As(err, &corrupt))
+	suite.Equal(&CorruptionError{Offset: 0, Record: 0, Reason: "truncated record"}, corrupt)
+	_, err = suite.bucket.NextRecord()
+	suite.Equal(io.EOF, err)
+}
+
+func (suite *BucketTestSuite) TestVerify() {
+	suite.bucket.framed = true
+	suite.bucket.checksum = true
+	suite.NoError(suite.bucket.Open())
+	suite.NoError(suite.bucket.Write([]byte("hello")))
+	suite.NoError(suite.bucket.Write([]byte("world")))
+	suite.NoError(suite.bucket.Write([]byte("again")))
+	suite.NoError(suite.bucket.Close())
+	problems, err := suite.bucket.Verify()
+	suite.NoError(err)
+	suite.Empty(problems)
+}
+
+func (suite *BucketTestSuite) TestVerifyCorrupt() {
+	suite.bucket.framed = true
+	suite.bucket.checksum = true
+	suite.NoError(suite.bucket.Open())
+	suite.NoError(suite.bucket.Write([]byte("hello")))
+	suite.NoError(suite.bucket.Write([]byte("world")))
+	suite.NoError(suite.bucket.Write([]byte("again")))
+	_, err := suite.bucket.file.WriteAt([]byte("H"), 8)
+	suite.NoError(err)
+	suite.NoError(suite.bucket.file.Truncate(36))
+	suite.NoError(suite.bucket.Close())
+	problems, err := suite.bucket.Verify()
+	suite.NoError(err)
+	suite.Equal([]*CorruptionError{
+		{Offset: 0, Record: 0, Reason: "checksum mismatch"},
+		{Offset: 26, Record: 2, Reason: "truncated record"},
+	}, problems)
+}
+
+func (suite *BucketTestSuite) TestVerifyStillOpen() {
+	suite.bucket.framed = true
+	suite.NoError(suite.bucket.Open())
+	_, err := suite.bucket.Verify()
+	suite.True(errors.Is(err, ErrBucketNotSealed))
+}
+
+func (suite *BucketTestSuite) TestWriteBuffer() {
+	suite.bucket.writeBuffer = 1024
+	suite.NoError(suite.bucket.Open())
+	data := []byte("hello world\n")
+	suite.NoError(suite.bucket.Write(data))
+	suite.EqualValues(len(data), suite.bucket.Bytes())
+	suite.EqualValues(0, suite.bucket.DiskBytes())
+	suite.assertFileEmpty()
+	suite.NoError(suite.bucket.Close())
+	suite.EqualValues(len(data), suite.bucket.DiskBytes())
+	actual, err := ioutil.ReadAll(suite.bucket)
+	suite.NoError(err)
+	suite.Equal(data, actual)
+}
+
+func (suite *BucketTestSuite) TestWriteBufferFull() {
+	suite.bucket.writeBuffer = 16
+	suite.NoError(suite.bucket.Open())
+	data := []byte("hello world\n")
+	suite.NoError(suite.bucket.Write(data))
+	suite.EqualValues(0, suite.bucket.DiskBytes())
+	suite.NoError(suite.bucket.Write(data))
+	suite.EqualValues(16, suite.bucket.DiskBytes())
+}
+
+func (suite *BucketTestSuite) TestWriteBufferSync() {
+	suite.bucket.writeBuffer = 1024
+	suite.NoError(suite.bucket.Open())
+	data := []byte("hello world\n")
+	suite.NoError(suite.bucket.Write(data))
+	suite.NoError(suite.bucket.Sync())
+	suite.assertFileContains(data)
+}
+
+func (suite *BucketTestSuite) TestFlushInterval() {
+	suite.bucket.writeBuffer = 1024
+	suite.bucket.flushInterval = time.Second
+	ticker := newManualTicker()
+	suite.bucket.ticker = ticker.start
+	suite.NoError(suite.bucket.Open())
+	data := []byte("hello world\n")
+	suite.NoError(suite.bucket.Write(data))
+	suite.EqualValues(0, suite.bucket.DiskBytes())
+	ticker.fire()
+	suite.EqualValues(len(data), suite.bucket.DiskBytes())
+	suite.assertFileContains(data)
+	suite.NoError(suite.bucket.Close())
 }
 
 func (suite *BucketTestSuite) assertFileExists(expected bool) {
@@ -123,3 +359,54 @@ func (suite *BucketTestSuite) assertFileContains(data []byte) {
 	suite.NoError(err)
 	suite.True(contains)
 }
+
+func BenchmarkWrite(b *testing.B) {
+	benchmarkWrite(b, BucketOptions{})
+}
+
+func BenchmarkWriteCoalesced(b *testing.B) {
+	benchmarkWrite(b, BucketOptions{WriteBuffer: 64 * 1024})
+}
+
+// benchmarkWrite issues small writes from many goroutines against a real file,
+// since the cost of the syscalls is what coalescing is meant to avoid.
+func benchmarkWrite(b *testing.B, o BucketOptions) {
+	dir, err := ioutil.TempDir("", "go-data-buffer")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	o.Path = filepath.Join(dir, "bucket")
+	bucket := NewBucket(o)
+	if err := bucket.Open(); err != nil {
+		b.Fatal(err)
+	}
+
+	data := []byte("000001: hello world\n")
+	b.SetBytes(int64(len(data)))
+	b.SetParallelism(100)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := bucket.Write(data); err != nil {
+				b.Error(err)
+			}
+		}
+	})
+
+	if err := bucket.Close(); err != nil {
+		b.Fatal(err)
+	}
+}
+
+// openBucket creates and opens a bucket at ./test/a on the given filesystem,
+// which is where most tests start.
+func openBucket(t *testing.T, fs afero.Fs, o BucketOptions) *Bucket {
+	t.Helper()
+	o.Path = "./test/a"
+	o.Fs = fs
+	bucket := NewBucket(o)
+	assert.NoError(t, bucket.Open())
+	return bucket
+}
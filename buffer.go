@@ -1,8 +1,10 @@
 package buffer
 
 import (
+	"context"
 	"path/filepath"
 	"sync"
+	"time"
 
 	"github.com/spf13/afero"
 )
@@ -12,7 +14,27 @@ type Buffer struct {
 	sync.RWMutex
 	root    string
 	fs      afero.Fs
+	recover bool
 	buckets map[string]*Bucket
+	quota   *quota
+	names   NameMapper
+	events  *events
+	handles *handles
+	ceiling *ceiling
+	// chooses buckets for WriteKeyed
+	partitioner Partitioner
+	// the settings shared by every bucket in this buffer
+	bucket BucketOptions
+
+	window       time.Duration
+	windowGrace  time.Duration
+	windowFormat string
+	sealInterval time.Duration
+	onSeal       func(*Bucket)
+	sealErr      error
+	stop         chan struct{}
+	now          func() time.Time
+	ticker       func(time.Duration) (<-chan time.Time, func())
 }
 
 // NewBuffer creates a new instance from the given options.
@@ -23,15 +45,65 @@ func NewBuffer(o BufferOptions) *Buffer {
 		buckets: make(map[string]*Bucket),
 		root:    o.Root,
 		fs:      o.Fs,
+		recover: o.Recover,
+		quota:   newQuota(o),
+		names:   o.Names,
+		events:  newEvents(),
+		handles: newHandles(o.MaxOpenFiles),
+		ceiling: newCeiling(o.MaxMemoryBytes),
+
+		partitioner: o.Partitioner,
+
+		bucket: BucketOptions{
+			Fs:            o.Fs,
+			Framed:        o.Framed,
+			Checksum:      o.Checksum,
+			Compression:   o.Compression,
+			Encryption:    o.Encryption,
+			Format:        o.Format,
+			Header:        o.Header,
+			Sync:          o.Sync,
+			SyncWrites:    o.SyncWrites,
+			SyncInterval:  o.SyncInterval,
+			WriteBuffer:   o.WriteBuffer,
+			FlushInterval: o.FlushInterval,
+
+			MaxSegmentBytes:  o.MaxSegmentBytes,
+			MaxSegmentWrites: o.MaxSegmentWrites,
+
+			SpillBytes: o.SpillBytes,
+		},
+
+		window:       o.Window,
+		windowGrace:  o.WindowGrace,
+		windowFormat: o.WindowFormat,
+		sealInterval: o.SealInterval,
+		onSeal:       o.OnSeal,
+		now:          time.Now,
+		ticker:       newTicker,
 	}
 }
 
-// Open prepares for writes by creating the directory on disk.
+// Open prepares for writes by creating the directory on disk. When recovery is
+// enabled, buckets are also restored for any files already in the directory.
+// For a windowed buffer, this also starts sealing windows in the background.
 func (b *Buffer) Open() error {
 	b.Lock()
 	defer b.Unlock()
 
-	return b.create()
+	if err := b.create(); err != nil {
+		return err
+	}
+
+	if b.recover {
+		if err := b.restore("", nil); err != nil {
+			return err
+		}
+	}
+
+	b.background()
+
+	return nil
 }
 
 func (b *Buffer) create() error {
@@ -43,11 +115,19 @@ func (b *Buffer) create() error {
 }
 
 // Close switches all the buckets to stop accepting writes in preparation for
-// reading.
+// reading. Buckets for windows that have not been sealed yet are closed too,
+// but they are not passed to OnSeal.
 func (b *Buffer) Close() error {
 	b.Lock()
 	defer b.Unlock()
 
+	b.halt()
+
+	if err := b.sealErr; err != nil {
+		b.sealErr = nil
+		return err
+	}
+
 	for _, bucket := range b.buckets {
 		if err := bucket.Close(); err != nil {
 			return err
@@ -57,9 +137,28 @@ func (b *Buffer) Close() error {
 	return nil
 }
 
+// Sync commits every bucket to stable storage, regardless of the sync
+// policy in use.
+func (b *Buffer) Sync() error {
+	b.RLock()
+	defer b.RUnlock()
+
+	for _, bucket := range b.buckets {
+		if err := bucket.Sync(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // Destroy deletes the entire directory and it's contents. Use this to clean up
 // when you are done using the buffer.
 func (b *Buffer) Destroy() error {
+	b.Lock()
+	b.halt()
+	b.Unlock()
+
 	if err := b.Reset(); err != nil {
 		return err
 	}
@@ -77,48 +176,203 @@ func (b *Buffer) Destroy() error {
 // Write adds the given data to named bucket. It is threadsafe and can be called
 // concurrently, while maintaining the order in your buckets.
 func (b *Buffer) Write(name string, data ...[]byte) error {
-	bucket, err := b.Get(name)
+	return b.write(context.Background(), []string{name}, data)
+}
+
+// WriteContext is the same as Write, but gives up as soon as the context is
+// done while waiting on locks or, when the quota policy is QuotaBlock, space.
+func (b *Buffer) WriteContext(ctx context.Context, name string, data ...[]byte) error {
+	return b.write(ctx, []string{name}, data)
+}
+
+// WritePath is the same as Write, but for a nested bucket (see GetPath).
+func (b *Buffer) WritePath(path []string, data ...[]byte) error {
+	return b.write(context.Background(), path, data)
+}
+
+// WriteRow adds a single row to the named bucket, for buffers using FormatCSV.
+func (b *Buffer) WriteRow(name string, row []string) error {
+	if b.bucket.Format != FormatCSV {
+		return ErrNotCSV
+	}
+
+	line, err := csvLine(row)
+	if err != nil {
+		return err
+	}
+	return b.write(context.Background(), []string{name}, [][]byte{line})
+}
+
+// WriteKeyed adds the given data to the bucket chosen by the partitioner for
+// the given key.
+func (b *Buffer) WriteKeyed(key string, data ...[]byte) error {
+	return b.WriteKeyedContext(context.Background(), key, data...)
+}
+
+// WriteKeyedContext is the same as WriteKeyed, but gives up as soon as the
+// context is done (see WriteContext).
+func (b *Buffer) WriteKeyedContext(ctx context.Context, key string, data ...[]byte) error {
+	if b.partitioner == nil {
+		return ErrNoPartitioner
+	}
+
+	path, err := b.partitioner.Partition(key, data)
+	if err != nil {
+		return err
+	}
+
+	return b.write(ctx, path, data)
+}
+
+func (b *Buffer) write(ctx context.Context, path []string, data [][]byte) error {
+	bucket, err := b.get(ctx, path)
 	if err != nil {
 		return err
 	}
 
-	if err := bucket.Write(data...); err != nil {
+	data, err = bucket.prepare(data)
+	if err != nil {
+		return bucket.fail("write", err)
+	}
+
+	n := size(data)
+	warn, err := b.quota.reserve(ctx, bucket.key, n)
+	if err != nil {
+		return bucket.fail("write", err)
+	}
+
+	if written, err := bucket.writeContext(ctx, data); err != nil {
+		// give back whatever the bucket did not take, eg: when it is sealed
+		b.quota.release(bucket.key, n-uint64(written))
 		return err
 	}
 
+	if warn.bucket {
+		bucket.RLock()
+		b.events.emit(bucket.event(EventQuotaWarning))
+		bucket.RUnlock()
+	}
+	if warn.total {
+		b.events.emit(Event{
+			Type:   EventQuotaWarning,
+			Path:   b.root,
+			Writes: b.Writes(),
+			Bytes:  warn.usage,
+		})
+	}
+
 	return nil
 }
 
 // Get can be used to retrieve a single bucket. If the named bucket does not
 // exist, it will be created.
 func (b *Buffer) Get(name string) (*Bucket, error) {
-	b.Lock()
+	return b.get(context.Background(), []string{name})
+}
+
+// GetContext is the same as Get, but gives up as soon as the context is done.
+func (b *Buffer) GetContext(ctx context.Context, name string) (*Bucket, error) {
+	return b.get(ctx, []string{name})
+}
+
+// GetPath retrieves a nested bucket, where each name in the path is a level of
+// subdirectories, eg: GetPath("2026-10-16", "acme"). The bucket will be created
+// if it does not exist yet.
+func (b *Buffer) GetPath(path ...string) (*Bucket, error) {
+	return b.get(context.Background(), path)
+}
+
+func (b *Buffer) get(ctx context.Context, path []string) (*Bucket, error) {
+	key, err := b.key(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := lockContext(ctx, b.RLocker()); err != nil {
+		return nil, b.fail("get", path, key, err)
+	}
+	bucket, ok := b.buckets[key]
+	b.RUnlock()
+	if ok {
+		return bucket, nil
+	}
+
+	// this may need to wait for space, so it cannot hold onto the lock
+	if err := b.quota.admit(ctx, key); err != nil {
+		return nil, b.fail("get", path, key, err)
+	}
+
+	if err := lockContext(ctx, b); err != nil {
+		return nil, b.fail("get", path, key, err)
+	}
 	defer b.Unlock()
 
-	if bucket, ok := b.buckets[name]; ok {
+	if bucket, ok := b.buckets[key]; ok {
 		return bucket, nil
 	}
 
-	bucket := NewBucket(BucketOptions{
-		Path: filepath.Join(b.root, name),
-		Fs:   b.fs,
-	})
+	if existing := b.conflicts(path); existing != nil {
+		b.quota.remove(key)
+		return nil, &InvalidNameError{
+			Name:   key,
+			Reason: "overlaps with the bucket " + existing.key,
+		}
+	}
+
+	bucket = b.newBucket(key, path)
 	if err := bucket.Open(); err != nil {
+		b.quota.remove(key)
 		return nil, err
 	}
 
-	b.buckets[name] = bucket
+	b.buckets[key] = bucket
+	b.events.emit(bucket.event(EventCreated))
 	return bucket, nil
 }
 
-// Buckets retrieves the list of bucket names.
+// key maps a bucket path to the location of its file relative to the root
+// directory, which is also used to identify the bucket internally.
+func (b *Buffer) key(path []string) (string, error) {
+	if len(path) == 0 {
+		return "", &InvalidNameError{Reason: "path cannot be empty"}
+	}
+
+	parts := make([]string, len(path))
+	for i, name := range path {
+		part, err := b.names.Path(name)
+		if err != nil {
+			return "", err
+		}
+		parts[i] = part
+	}
+	return filepath.Join(parts...), nil
+}
+
+// newBucket creates a bucket for the given file within the root directory.
+func (b *Buffer) newBucket(key string, path []string) *Bucket {
+	o := b.bucket
+	o.Path = filepath.Join(b.root, key)
+	bucket := NewBucket(o)
+	bucket.key = key
+	bucket.name = path
+	bucket.window = b.windowEnd(path)
+	bucket.events = b.events
+	bucket.handles = b.handles
+	bucket.ceiling = b.ceiling
+	return bucket
+}
+
+// Buckets retrieves the list of bucket names. Only buckets at the top level are
+// included, use Children to explore nested buckets.
 func (b *Buffer) Buckets() []string {
 	b.RLock()
 	defer b.RUnlock()
 
 	list := make([]string, 0, len(b.buckets))
-	for name := range b.buckets {
-		list = append(list, name)
+	for _, bucket := range b.buckets {
+		if len(bucket.name) == 1 {
+			list = append(list, bucket.name[0])
+		}
 	}
 	return list
 }
@@ -137,6 +391,84 @@ func (b *Buffer) Reset() error {
 
 	// reset the internal list of buckets
 	b.buckets = make(map[string]*Bucket)
+	b.quota.reset()
+
+	return nil
+}
+
+// CloseBucket seals a single bucket, so it stops accepting writes and can be
+// read while the rest of the buffer carries on. Writing to it afterwards fails
+// with ErrBucketSealed until it is reopened with ReopenBucket.
+func (b *Buffer) CloseBucket(name string) error {
+	bucket, key, err := b.lookup(name)
+	if err != nil {
+		return err
+	} else if bucket == nil {
+		return b.fail("close", []string{name}, key, ErrBucketNotFound)
+	}
+
+	return bucket.Close()
+}
+
+// ReopenBucket starts accepting writes for a bucket sealed by CloseBucket (or
+// Close) again, appending to the data already written.
+func (b *Buffer) ReopenBucket(name string) error {
+	bucket, key, err := b.lookup(name)
+	if err != nil {
+		return err
+	} else if bucket == nil {
+		return b.fail("reopen", []string{name}, key, ErrBucketNotFound)
+	}
+
+	return bucket.Reopen()
+}
+
+// fail wraps an error for a bucket that has not been created (yet), see
+// Bucket.fail for the rest.
+func (b *Buffer) fail(op string, path []string, key string, err error) error {
+	return &BucketError{Op: op, Name: path, Path: filepath.Join(b.root, key), Err: err}
+}
+
+// lookup finds an existing bucket without creating it, along with its key.
+func (b *Buffer) lookup(name string) (*Bucket, string, error) {
+	key, err := b.key([]string{name})
+	if err != nil {
+		return nil, "", err
+	}
+
+	b.RLock()
+	defer b.RUnlock()
+
+	return b.buckets[key], key, nil
+}
+
+// DestroyBucket removes a single bucket from the buffer, deleting it from disk
+// and freeing up the space it was using towards any quotas.
+func (b *Buffer) DestroyBucket(name string) error {
+	key, err := b.key([]string{name})
+	if err != nil {
+		return err
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	bucket, ok := b.buckets[key]
+	if !ok {
+		return nil
+	}
+
+	return b.destroy(bucket)
+}
+
+// destroy removes a bucket, the caller must hold the lock.
+func (b *Buffer) destroy(bucket *Bucket) error {
+	if err := bucket.Destroy(); err != nil {
+		return err
+	}
+
+	delete(b.buckets, bucket.key)
+	b.quota.remove(bucket.key)
 
 	return nil
 }
@@ -167,6 +499,24 @@ func (b *Buffer) Bytes() uint64 {
 	return count
 }
 
+// DiskBytes retrieves a full count of the bytes written to disk for all the
+// buckets in this buffer, after compression.
+func (b *Buffer) DiskBytes() uint64 {
+	b.RLock()
+	defer b.RUnlock()
+
+	var count uint64
+	for _, bucket := range b.buckets {
+		count += bucket.DiskBytes()
+	}
+	return count
+}
+
+// segmented indicates whether buckets are split into multiple files.
+func (b *Buffer) segmented() bool {
+	return b.bucket.MaxSegmentBytes > 0 || b.bucket.MaxSegmentWrites > 0
+}
+
 // Size retrieves the number of buckets in this buffer.
 func (b *Buffer) Size() uint {
 	b.RLock()
@@ -181,10 +531,77 @@ type BufferOptions struct {
 	Root string
 	// this is primarilly to allow for an in-memory filesystem during testing
 	Fs afero.Fs
+	// store each write as a distinct record in every bucket (see BucketOptions)
+	Framed bool
+	// add a checksum to every record (see BucketOptions)
+	Checksum bool
+	// the name of the compression to use for every bucket (see BucketOptions)
+	Compression string
+	// the keys used to encrypt every bucket (see BucketOptions)
+	Encryption KeyProvider
+	// when enabled, Open restores buckets for the files left in Root by a
+	// previous run instead of starting with an empty buffer
+	Recover bool
+	// the sync policy for every bucket (see BucketOptions)
+	Sync         SyncPolicy
+	SyncWrites   uint
+	SyncInterval time.Duration
+	// coalesce writes in memory for every bucket (see BucketOptions)
+	WriteBuffer   int
+	FlushInterval time.Duration
+	// split every bucket into segments (see BucketOptions)
+	MaxSegmentBytes  uint64
+	MaxSegmentWrites uint
+	// hold each bucket in memory until it grows past SpillBytes (see
+	// BucketOptions), and when MaxMemoryBytes is set, spill the largest
+	// buckets whenever the total held in memory would go past it
+	SpillBytes     uint64
+	MaxMemoryBytes uint64
+	// limits on the total bytes written to the buffer, the bytes written to
+	// any one bucket and the number of buckets (zero means unlimited)
+	MaxBytes       uint64
+	MaxBucketBytes uint64
+	MaxBuckets     uint
+	// what to do when a write would exceed one of the limits above
+	QuotaPolicy QuotaPolicy
+	// the fraction of MaxBytes or MaxBucketBytes (eg: 0.8) that triggers an
+	// EventQuotaWarning once usage goes past it (zero means no warnings)
+	QuotaWarning float64
+	// the most files to keep open at once, beyond which the least recently used
+	// buckets close their files until they are next written to or read from
+	// (zero means unlimited, each segmented bucket counts as one)
+	MaxOpenFiles int
+	// how the data in every bucket is laid out (see BucketOptions)
+	Format Format
+	Header []string
+	// converts bucket names to file names (defaults to EscapeMapper)
+	Names NameMapper
+	// chooses the bucket for each call to WriteKeyed
+	Partitioner Partitioner
+	// enables windowed mode for WriteAt, where each bucket covers a window of
+	// time and is closed automatically once the window plus the grace period
+	// has passed (checked every SealInterval, defaults to 1 second)
+	Window       time.Duration
+	WindowGrace  time.Duration
+	SealInterval time.Duration
+	// the layout used to name each window bucket after the time it starts, in
+	// UTC (defaults to "20060102T150405Z")
+	WindowFormat string
+	// called with each bucket after it has been sealed, eg: to upload it
+	OnSeal func(*Bucket)
 }
 
 func (o *BufferOptions) defaults() {
 	if o.Fs == nil {
 		o.Fs = afero.NewOsFs()
 	}
+	if o.Names == nil {
+		o.Names = EscapeMapper{}
+	}
+	if o.WindowFormat == "" {
+		o.WindowFormat = defaultWindowFormat
+	}
+	if o.SealInterval == 0 {
+		o.SealInterval = time.Second
+	}
 }
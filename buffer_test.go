@@ -1,6 +1,7 @@
 package buffer
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 	"sync"
@@ -32,6 +33,32 @@ func (suite *BufferTestSuite) TestOpen() {
 	suite.assertBufferRootExists(true)
 }
 
+func (suite *BufferTestSuite) TestOpenRecover() {
+	data := []byte("hello world\n")
+	suite.buffer.bucket.Framed = true
+	suite.NoError(suite.buffer.Write("1", data))
+	suite.NoError(suite.buffer.Write("1", data))
+	suite.NoError(suite.buffer.Write("2", data))
+	suite.NoError(afero.WriteFile(suite.buffer.fs, "./test/.hidden", data, 0644))
+	recovered := NewBuffer(BufferOptions{
+		Root:    "./test",
+		Fs:      suite.buffer.fs,
+		Framed:  true,
+		Recover: true,
+	})
+	suite.NoError(recovered.Open())
+	suite.Len(recovered.Buckets(), 2)
+	suite.Contains(recovered.Buckets(), "1")
+	suite.Contains(recovered.Buckets(), "2")
+	suite.EqualValues(3, recovered.Writes())
+	suite.EqualValues(3*len(data), recovered.Bytes())
+	suite.NoError(recovered.Write("2", data))
+	suite.NoError(recovered.Close())
+	bucket, err := recovered.Get("2")
+	suite.NoError(err)
+	suite.EqualValues(2, bucket.Writes())
+}
+
 func (suite *BufferTestSuite) TestClose() {
 	data := []byte("hello world\n")
 	suite.NoError(suite.buffer.Write("1", data))
@@ -41,6 +68,28 @@ func (suite *BufferTestSuite) TestClose() {
 	suite.assertBucketFileContains("2", data)
 }
 
+func (suite *BufferTestSuite) TestCloseBucket() {
+	data := []byte("hello world\n")
+	suite.NoError(suite.buffer.Write("1", data))
+	suite.NoError(suite.buffer.Write("2", data))
+	suite.NoError(suite.buffer.CloseBucket("1"))
+	suite.True(errors.Is(suite.buffer.CloseBucket("missing"), ErrBucketNotFound))
+	suite.True(errors.Is(suite.buffer.Write("1", data), ErrBucketSealed))
+	suite.NoError(suite.buffer.Write("2", data))
+	suite.assertBucketFileContains("1", data)
+}
+
+func (suite *BufferTestSuite) TestReopenBucket() {
+	data := []byte("hello world\n")
+	suite.NoError(suite.buffer.Write("1", data))
+	suite.NoError(suite.buffer.CloseBucket("1"))
+	suite.NoError(suite.buffer.ReopenBucket("1"))
+	suite.NoError(suite.buffer.Write("1", data))
+	suite.NoError(suite.buffer.Close())
+	suite.assertBucketFileContains("1", append(data, data...))
+	suite.True(errors.Is(suite.buffer.ReopenBucket("missing"), ErrBucketNotFound))
+}
+
 func (suite *BufferTestSuite) TestDestroy() {
 	suite.NoError(suite.buffer.Open())
 	suite.NoError(suite.buffer.Destroy())
@@ -101,6 +150,21 @@ func (suite *BufferTestSuite) TestBytes() {
 	suite.EqualValues(2*len(data), suite.buffer.Bytes())
 }
 
+func (suite *BufferTestSuite) TestDiskBytes() {
+	suite.buffer.bucket.Compression = "gzip"
+	data := []byte("hello world\n")
+	suite.NoError(suite.buffer.Write("1", data))
+	suite.NoError(suite.buffer.Write("2", data))
+	suite.NoError(suite.buffer.Close())
+	suite.EqualValues(2*len(data), suite.buffer.Bytes())
+	one, err := suite.buffer.Get("1")
+	suite.NoError(err)
+	two, err := suite.buffer.Get("2")
+	suite.NoError(err)
+	suite.NotZero(one.DiskBytes())
+	suite.EqualValues(one.DiskBytes()+two.DiskBytes(), suite.buffer.DiskBytes())
+}
+
 func (suite *BufferTestSuite) TestSize() {
 	data := []byte("hello world\n")
 	suite.NoError(suite.buffer.Write("1", data))
@@ -108,6 +172,21 @@ func (suite *BufferTestSuite) TestSize() {
 	suite.EqualValues(2, suite.buffer.Size())
 }
 
+func (suite *BufferTestSuite) TestFramed() {
+	suite.buffer.bucket.Framed = true
+	suite.NoError(suite.buffer.Write("1", []byte("hello")))
+	suite.NoError(suite.buffer.Write("1", []byte("world")))
+	suite.NoError(suite.buffer.Close())
+	bucket, err := suite.buffer.Get("1")
+	suite.NoError(err)
+	record, err := bucket.NextRecord()
+	suite.NoError(err)
+	suite.Equal("hello", string(record))
+	record, err = bucket.NextRecord()
+	suite.NoError(err)
+	suite.Equal("world", string(record))
+}
+
 func (suite *BufferTestSuite) TestBatchWrites() {
 	wg := new(sync.WaitGroup)
 	a := suite.write(wg, "a", 50)
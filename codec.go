@@ -0,0 +1,119 @@
+package buffer
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+)
+
+// Codec converts values to and from the data stored in a bucket, for use with
+// TypedBuffer and TypedBucket. Each value is stored by a single call to Write.
+type Codec[T any] interface {
+	Encode(value T) ([]byte, error)
+	Decode(data []byte) (T, error)
+}
+
+// Delimited is implemented by codecs that end each value with a newline and do
+// not use newlines anywhere else, so values can be read back from buckets that
+// are not framed. Other codecs need framed buckets.
+type Delimited interface {
+	Delimited() bool
+}
+
+// JSONCodec implements Codec using encoding/json. Each value is written on a
+// line of its own, so buckets that are not framed hold newline-delimited JSON.
+type JSONCodec[T any] struct{}
+
+// Encode implements Codec.
+func (JSONCodec[T]) Encode(value T) ([]byte, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// Decode implements Codec.
+func (JSONCodec[T]) Decode(data []byte) (T, error) {
+	var value T
+	err := json.Unmarshal(data, &value)
+	return value, err
+}
+
+// Delimited implements Delimited.
+func (JSONCodec[T]) Delimited() bool {
+	return true
+}
+
+// GobCodec implements Codec using encoding/gob. Each value is encoded on its
+// own, along with a description of its type, so buckets must be framed.
+type GobCodec[T any] struct{}
+
+// Encode implements Codec.
+func (GobCodec[T]) Encode(value T) ([]byte, error) {
+	var data bytes.Buffer
+	if err := gob.NewEncoder(&data).Encode(value); err != nil {
+		return nil, err
+	}
+	return data.Bytes(), nil
+}
+
+// Decode implements Codec.
+func (GobCodec[T]) Decode(data []byte) (T, error) {
+	var value T
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&value)
+	return value, err
+}
+
+// TextCodec implements Codec by writing each value on a line of its own. It
+// works for strings, and for types that implement encoding.TextMarshaler and
+// encoding.TextUnmarshaler. (the latter usually via a pointer) Values that
+// contain a newline cannot be written.
+type TextCodec[T any] struct{}
+
+// Encode implements Codec.
+func (TextCodec[T]) Encode(value T) ([]byte, error) {
+	var data []byte
+	switch v := any(value).(type) {
+	case string:
+		data = []byte(v)
+	case encoding.TextMarshaler:
+		text, err := v.MarshalText()
+		if err != nil {
+			return nil, err
+		}
+		data = text
+	default:
+		return nil, fmt.Errorf("%T cannot be encoded as text", value)
+	}
+
+	if bytes.IndexByte(data, '\n') >= 0 {
+		return nil, fmt.Errorf("text %q contains a newline", data)
+	}
+	return append(data, '\n'), nil
+}
+
+// Decode implements Codec.
+func (TextCodec[T]) Decode(data []byte) (T, error) {
+	var value T
+	data = bytes.TrimSuffix(data, []byte("\n"))
+
+	switch v := any(&value).(type) {
+	case *string:
+		*v = string(data)
+	case encoding.TextUnmarshaler:
+		if err := v.UnmarshalText(data); err != nil {
+			return value, err
+		}
+	default:
+		return value, fmt.Errorf("%T cannot be decoded from text", value)
+	}
+	return value, nil
+}
+
+// Delimited implements Delimited.
+func (TextCodec[T]) Delimited() bool {
+	return true
+}
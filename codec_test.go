@@ -0,0 +1,81 @@
+package buffer
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type CodecTestSuite struct {
+	suite.Suite
+}
+
+func TestCodecTestSuite(t *testing.T) {
+	suite.Run(t, new(CodecTestSuite))
+}
+
+type codecRecord struct {
+	ID   int
+	Name string
+}
+
+func (suite *CodecTestSuite) TestJSON() {
+	codec := JSONCodec[codecRecord]{}
+	data, err := codec.Encode(codecRecord{ID: 1, Name: "a"})
+	suite.NoError(err)
+	suite.Equal("{\"ID\":1,\"Name\":\"a\"}\n", string(data))
+
+	value, err := codec.Decode(data)
+	suite.NoError(err)
+	suite.Equal(codecRecord{ID: 1, Name: "a"}, value)
+
+	_, err = codec.Decode([]byte("nope"))
+	suite.Error(err)
+}
+
+func (suite *CodecTestSuite) TestGob() {
+	codec := GobCodec[codecRecord]{}
+	data, err := codec.Encode(codecRecord{ID: 1, Name: "a\nb"})
+	suite.NoError(err)
+
+	value, err := codec.Decode(data)
+	suite.NoError(err)
+	suite.Equal(codecRecord{ID: 1, Name: "a\nb"}, value)
+}
+
+func (suite *CodecTestSuite) TestTextString() {
+	codec := TextCodec[string]{}
+	data, err := codec.Encode("hello")
+	suite.NoError(err)
+	suite.Equal("hello\n", string(data))
+
+	value, err := codec.Decode(data)
+	suite.NoError(err)
+	suite.Equal("hello", value)
+
+	_, err = codec.Encode("hello\nworld")
+	suite.EqualError(err, `text "hello\nworld" contains a newline`)
+}
+
+func (suite *CodecTestSuite) TestTextMarshaler() {
+	codec := TextCodec[net.IP]{}
+	data, err := codec.Encode(net.IPv4(127, 0, 0, 1))
+	suite.NoError(err)
+	suite.Equal("127.0.0.1\n", string(data))
+
+	value, err := codec.Decode(data)
+	suite.NoError(err)
+	suite.True(net.IPv4(127, 0, 0, 1).Equal(value))
+
+	_, err = codec.Decode([]byte("nope\n"))
+	suite.Error(err)
+}
+
+func (suite *CodecTestSuite) TestTextUnsupported() {
+	codec := TextCodec[int]{}
+	_, err := codec.Encode(1)
+	suite.EqualError(err, "int cannot be encoded as text")
+	_, err = codec.Decode([]byte("1\n"))
+	suite.EqualError(err, "int cannot be decoded from text")
+}
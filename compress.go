@@ -0,0 +1,139 @@
+package buffer
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Compressor adds transparent compression to bucket files. Writers are closed
+// when the bucket is closed, which must flush any remaining data.
+//
+// A file can contain several compressed streams one after the other (eg: when
+// a bucket is recovered and appended to), so readers should not consume more
+// input than their own stream when given an io.ByteReader.
+type Compressor interface {
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+var (
+	compressorsMu sync.RWMutex
+	compressors   = map[string]Compressor{
+		"gzip": GzipCompressor{Level: gzip.DefaultCompression},
+		"zlib": ZlibCompressor{Level: zlib.DefaultCompression},
+	}
+)
+
+// RegisterCompressor makes a compressor available by name, so it can be used
+// via the Compression field of BucketOptions and BufferOptions. Registering
+// an existing name will replace it.
+func RegisterCompressor(name string, c Compressor) {
+	compressorsMu.Lock()
+	defer compressorsMu.Unlock()
+
+	compressors[name] = c
+}
+
+func lookupCompressor(name string) (Compressor, error) {
+	compressorsMu.RLock()
+	defer compressorsMu.RUnlock()
+
+	c, ok := compressors[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown compression %q", name)
+	}
+	return c, nil
+}
+
+// GzipCompressor implements Compressor using compress/gzip, it is registered
+// as "gzip" with the default compression level.
+type GzipCompressor struct {
+	Level int
+}
+
+// NewWriter implements Compressor.
+func (c GzipCompressor) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return gzip.NewWriterLevel(w, c.Level)
+}
+
+// NewReader implements Compressor.
+func (c GzipCompressor) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+// ZlibCompressor implements Compressor using compress/zlib, it is registered
+// as "zlib" with the default compression level.
+type ZlibCompressor struct {
+	Level int
+}
+
+// NewWriter implements Compressor.
+func (c ZlibCompressor) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return zlib.NewWriterLevel(w, c.Level)
+}
+
+// NewReader implements Compressor.
+func (c ZlibCompressor) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return zlib.NewReader(r)
+}
+
+// multistream decompresses a series of compressed streams that were written
+// one after the other, starting a new reader each time one is exhausted.
+type multistream struct {
+	r          *bufio.Reader
+	compressor Compressor
+	current    io.ReadCloser
+}
+
+func (m *multistream) Read(p []byte) (int, error) {
+	for {
+		if m.current == nil {
+			if _, err := m.r.Peek(1); err != nil {
+				return 0, err
+			}
+			reader, err := m.compressor.NewReader(m.r)
+			if err != nil {
+				return 0, err
+			}
+			m.current = reader
+		}
+
+		n, err := m.current.Read(p)
+		if err == io.EOF {
+			if err := m.current.Close(); err != nil {
+				return n, err
+			}
+			m.current = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+// flushCloser adapts a writer that only needs flushing to io.Closer.
+type flushCloser struct {
+	flusher
+}
+
+func (f flushCloser) Close() error {
+	return f.Flush()
+}
+
+// countingWriter keeps a running total of the bytes written through it.
+type countingWriter struct {
+	w     io.Writer
+	count *uint64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	*c.count += uint64(n)
+	return n, err
+}
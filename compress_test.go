@@ -0,0 +1,119 @@
+package buffer
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/suite"
+)
+
+type CompressTestSuite struct {
+	suite.Suite
+	fs afero.Fs
+}
+
+func TestCompressTestSuite(t *testing.T) {
+	suite.Run(t, new(CompressTestSuite))
+}
+
+func (suite *CompressTestSuite) SetupTest() {
+	suite.fs = afero.NewMemMapFs()
+}
+
+func (suite *CompressTestSuite) TestGzip() {
+	suite.assertRoundTrip("gzip")
+}
+
+func (suite *CompressTestSuite) TestZlib() {
+	suite.assertRoundTrip("zlib")
+}
+
+func (suite *CompressTestSuite) TestFramed() {
+	bucket := NewBucket(BucketOptions{
+		Path:        "./test/a",
+		Fs:          suite.fs,
+		Checksum:    true,
+		Compression: "gzip",
+	})
+	suite.NoError(bucket.Open())
+	suite.NoError(bucket.Write([]byte("hello")))
+	suite.NoError(bucket.Write([]byte("world")))
+	suite.NoError(bucket.Close())
+	record, err := bucket.NextRecord()
+	suite.NoError(err)
+	suite.Equal("hello", string(record))
+	record, err = bucket.NextRecord()
+	suite.NoError(err)
+	suite.Equal("world", string(record))
+	problems, err := bucket.Verify()
+	suite.NoError(err)
+	suite.Empty(problems)
+}
+
+func (suite *CompressTestSuite) TestDiskBytes() {
+	bucket := NewBucket(BucketOptions{
+		Path:        "./test/a",
+		Fs:          suite.fs,
+		Compression: "gzip",
+	})
+	data := bytes.Repeat([]byte("hello world\n"), 1000)
+	suite.NoError(bucket.Open())
+	suite.NoError(bucket.Write(data))
+	suite.NoError(bucket.Close())
+	suite.EqualValues(len(data), bucket.Bytes())
+	suite.True(bucket.DiskBytes() < bucket.Bytes())
+	info, err := suite.fs.Stat("./test/a")
+	suite.NoError(err)
+	suite.EqualValues(info.Size(), bucket.DiskBytes())
+}
+
+func (suite *CompressTestSuite) TestUnknown() {
+	bucket := NewBucket(BucketOptions{
+		Path:        "./test/a",
+		Fs:          suite.fs,
+		Compression: "unknown",
+	})
+	suite.EqualError(bucket.Open(), `open ./test/a: unknown compression "unknown"`)
+}
+
+func (suite *CompressTestSuite) TestRegister() {
+	RegisterCompressor("identity", identityCompressor{})
+	suite.assertRoundTrip("identity")
+}
+
+func (suite *CompressTestSuite) assertRoundTrip(compression string) {
+	bucket := NewBucket(BucketOptions{
+		Path:        "./test/a",
+		Fs:          suite.fs,
+		Compression: compression,
+	})
+	data := []byte("hello world\n")
+	suite.NoError(bucket.Open())
+	suite.NoError(bucket.Write(data))
+	suite.NoError(bucket.Write(data))
+	suite.NoError(bucket.Close())
+	actual, err := ioutil.ReadAll(bucket)
+	suite.NoError(err)
+	suite.Equal(append(data, data...), actual)
+}
+
+type identityCompressor struct{}
+
+func (identityCompressor) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return nopWriteCloser{w}, nil
+}
+
+func (identityCompressor) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return ioutil.NopCloser(r), nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
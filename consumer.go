@@ -0,0 +1,182 @@
+package buffer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/afero"
+)
+
+// Position is how far a consumer has read through a bucket.
+type Position struct {
+	// the number of bytes read, as they were given to Write (plus the headers
+	// for framed buckets)
+	Offset int64 `json:"offset"`
+	// the number of records read from a framed bucket
+	Record int `json:"record"`
+}
+
+// Consumer reads a bucket on behalf of a named group, keeping track of how far
+// it has got so that reading can carry on from there after a restart.
+type Consumer struct {
+	bucket    *Bucket
+	group     string
+	path      string
+	follower  *Follower
+	position  Position
+	committed Position
+}
+
+// Consumer starts reading this bucket for the named group, carrying on from
+// the last position committed for that group. The position is kept in a hidden
+// file next to the bucket, which is removed along with the bucket. Like Follow,
+// this can be used while the bucket is still accepting writes, in which case
+// reads wait until more is written or the context is done.
+//
+// Resuming reads through everything up to the committed position again, so it
+// costs about the same as reading that far.
+func (b *Bucket) Consumer(ctx context.Context, group string) (*Consumer, error) {
+	c, err := b.consumer(ctx, group)
+	return c, b.fail("consume", err)
+}
+
+func (b *Bucket) consumer(ctx context.Context, group string) (*Consumer, error) {
+	name, err := EscapeMapper{}.Path(group)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Consumer{
+		bucket: b,
+		group:  group,
+		path:   filepath.Join(b.offsetsPath(), name),
+	}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+
+	follower, err := b.Follow(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.follower = follower
+
+	if n, err := io.CopyN(ioutil.Discard, follower.reader, c.committed.Offset); err == io.EOF {
+		follower.Close()
+		return nil, fmt.Errorf("committed offset %d is past the end of the bucket at %d", c.committed.Offset, n)
+	} else if err != nil {
+		follower.Close()
+		return nil, err
+	}
+
+	follower.records.offset = c.committed.Offset
+	follower.records.index = c.committed.Record
+	c.position = c.committed
+	return c, nil
+}
+
+// Read implements io.Reader, carrying on from the current position.
+func (c *Consumer) Read(p []byte) (int, error) {
+	n, err := c.follower.reader.Read(p)
+	c.position.Offset += int64(n)
+	return n, c.bucket.fail("consume", err)
+}
+
+// NextRecord retrieves the next record from a framed bucket, carrying on from
+// the current position. (see Bucket.NextRecord)
+func (c *Consumer) NextRecord() ([]byte, error) {
+	if !c.bucket.framed {
+		return nil, c.bucket.fail("consume", ErrNotFramed)
+	}
+
+	record, err := c.follower.records.next()
+	c.position.Offset = c.follower.records.offset
+	c.position.Record = c.follower.records.index
+	return record, c.bucket.fail("consume", err)
+}
+
+// Position retrieves how far this consumer has read, which may not have been
+// committed yet.
+func (c *Consumer) Position() Position {
+	return c.position
+}
+
+// Committed retrieves the last position that was committed.
+func (c *Consumer) Committed() Position {
+	return c.committed
+}
+
+// Commit saves the current position, so that the next consumer for the same
+// group carries on from here. Only commit once everything read so far has
+// been dealt with.
+func (c *Consumer) Commit() error {
+	if err := c.save(c.position); err != nil {
+		return c.bucket.fail("commit", err)
+	}
+
+	c.committed = c.position
+	return nil
+}
+
+// Close stops reading, without committing anything.
+func (c *Consumer) Close() error {
+	return c.follower.Close()
+}
+
+// load reads the committed position, which is zero when nothing has been
+// committed yet.
+func (c *Consumer) load() error {
+	data, err := afero.ReadFile(c.bucket.fs, c.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, &c.committed)
+}
+
+// save replaces the committed position, the new one is written to a temporary
+// file first so a crash cannot leave behind a partial file.
+func (c *Consumer) save(position Position) error {
+	data, err := json.Marshal(position)
+	if err != nil {
+		return err
+	}
+
+	if err := c.bucket.fs.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return err
+	}
+
+	dir, base := filepath.Split(c.path)
+	temp := filepath.Join(dir, "."+base+".tmp")
+	file, err := c.bucket.fs.Create(temp)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return c.bucket.fs.Rename(temp, c.path)
+}
+
+// offsetsPath is the hidden directory next to the bucket that holds the
+// committed positions for each consumer group.
+func (b *Bucket) offsetsPath() string {
+	dir, base := filepath.Split(b.path)
+	return filepath.Join(dir, "."+base+".offsets")
+}
@@ -0,0 +1,179 @@
+package buffer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/suite"
+)
+
+type ConsumerTestSuite struct {
+	suite.Suite
+	fs     afero.Fs
+	bucket *Bucket
+}
+
+func TestConsumerTestSuite(t *testing.T) {
+	suite.Run(t, new(ConsumerTestSuite))
+}
+
+func (suite *ConsumerTestSuite) SetupTest() {
+	suite.fs = afero.NewMemMapFs()
+	suite.bucket = NewBucket(BucketOptions{Path: "./test/a", Fs: suite.fs, Framed: true})
+	suite.NoError(suite.bucket.Open())
+	for _, record := range []string{"a", "b", "c", "d"} {
+		suite.NoError(suite.bucket.Write([]byte(record)))
+	}
+	suite.NoError(suite.bucket.Close())
+}
+
+func (suite *ConsumerTestSuite) TestNextRecord() {
+	consumer := suite.consumer("group")
+	suite.assertRecords(consumer, "a", "b", "c", "d")
+	_, err := consumer.NextRecord()
+	suite.Equal(io.EOF, err)
+	suite.Equal(Position{Offset: 20, Record: 4}, consumer.Position())
+	suite.Equal(Position{}, consumer.Committed())
+}
+
+func (suite *ConsumerTestSuite) TestCommit() {
+	consumer := suite.consumer("group")
+	suite.assertRecords(consumer, "a", "b")
+	suite.NoError(consumer.Commit())
+	suite.Equal(Position{Offset: 10, Record: 2}, consumer.Committed())
+	suite.assertRecords(consumer, "c")
+	suite.NoError(consumer.Close())
+
+	resumed := suite.consumer("group")
+	suite.Equal(Position{Offset: 10, Record: 2}, resumed.Position())
+	suite.assertRecords(resumed, "c", "d")
+}
+
+func (suite *ConsumerTestSuite) TestGroups() {
+	first := suite.consumer("first")
+	suite.assertRecords(first, "a", "b", "c")
+	suite.NoError(first.Commit())
+	second := suite.consumer("second")
+	suite.assertRecords(second, "a")
+	suite.NoError(second.Commit())
+	suite.assertRecords(suite.consumer("first"), "d")
+	suite.assertRecords(suite.consumer("second"), "b")
+}
+
+func (suite *ConsumerTestSuite) TestSidecar() {
+	consumer := suite.consumer("a/b")
+	suite.assertRecords(consumer, "a")
+	suite.NoError(consumer.Commit())
+	data, err := afero.ReadFile(suite.fs, "test/.a.offsets/a%2Fb")
+	suite.NoError(err)
+	suite.JSONEq(`{"offset":5,"record":1}`, string(data))
+}
+
+func (suite *ConsumerTestSuite) TestRead() {
+	bucket := NewBucket(BucketOptions{Path: "./test/b", Fs: suite.fs})
+	suite.NoError(bucket.Open())
+	suite.NoError(bucket.Write([]byte("hello world")))
+	suite.NoError(bucket.Close())
+	consumer, err := bucket.Consumer(context.Background(), "group")
+	suite.NoError(err)
+	p := make([]byte, 6)
+	_, err = io.ReadFull(consumer, p)
+	suite.NoError(err)
+	suite.NoError(consumer.Commit())
+	consumer, err = bucket.Consumer(context.Background(), "group")
+	suite.NoError(err)
+	_, err = io.ReadFull(consumer, p[:5])
+	suite.NoError(err)
+	suite.Equal("world", string(p[:5]))
+}
+
+func (suite *ConsumerTestSuite) TestFollow() {
+	bucket := NewBucket(BucketOptions{Path: "./test/b", Fs: suite.fs, Framed: true})
+	suite.NoError(bucket.Open())
+	suite.NoError(bucket.Write([]byte("a")))
+	consumer, err := bucket.Consumer(context.Background(), "group")
+	suite.NoError(err)
+	suite.assertRecords(consumer, "a")
+	suite.NoError(consumer.Commit())
+	suite.NoError(bucket.Write([]byte("b")))
+	suite.NoError(bucket.Close())
+	consumer, err = bucket.Consumer(context.Background(), "group")
+	suite.NoError(err)
+	suite.assertRecords(consumer, "b")
+}
+
+func (suite *ConsumerTestSuite) TestPastEnd() {
+	consumer := suite.consumer("group")
+	suite.assertRecords(consumer, "a", "b", "c", "d")
+	suite.NoError(consumer.Commit())
+	suite.NoError(suite.bucket.Open())
+	suite.NoError(suite.bucket.Write([]byte("a")))
+	suite.NoError(suite.bucket.Close())
+	// opening again starts over, so the old position is gone
+	suite.assertRecords(suite.consumer("group"), "a")
+
+	consumer = suite.consumer("group")
+	consumer.position = Position{Offset: 100}
+	suite.NoError(consumer.Commit())
+	_, err := suite.bucket.Consumer(context.Background(), "group")
+	var bucketErr *BucketError
+	suite.True(errors.As(err, &bucketErr))
+}
+
+func (suite *ConsumerTestSuite) TestDestroy() {
+	consumer := suite.consumer("group")
+	suite.NoError(consumer.Commit())
+	suite.NoError(suite.bucket.Destroy())
+	exists, err := afero.DirExists(suite.fs, "test/.a.offsets")
+	suite.NoError(err)
+	suite.False(exists)
+}
+
+func (suite *ConsumerTestSuite) TestBufferRecover() {
+	buffer := NewBuffer(BufferOptions{Root: "./buffer", Fs: suite.fs, Framed: true})
+	suite.NoError(buffer.Write("a", []byte("hello")))
+	suite.NoError(buffer.Write("a", []byte("world")))
+	suite.NoError(buffer.Close())
+	bucket, err := buffer.Get("a")
+	suite.NoError(err)
+	consumer, err := bucket.Consumer(context.Background(), "group")
+	suite.NoError(err)
+	suite.assertRecords(consumer, "hello")
+	suite.NoError(consumer.Commit())
+
+	recovered := NewBuffer(BufferOptions{Root: "./buffer", Fs: suite.fs, Framed: true, Recover: true})
+	suite.NoError(recovered.Open())
+	suite.Equal([]string{"a"}, recovered.Buckets())
+	suite.NoError(recovered.Close())
+	bucket, err = recovered.Get("a")
+	suite.NoError(err)
+	consumer, err = bucket.Consumer(context.Background(), "group")
+	suite.NoError(err)
+	suite.assertRecords(consumer, "world")
+}
+
+func (suite *ConsumerTestSuite) TestUnframed() {
+	bucket := NewBucket(BucketOptions{Path: "./test/b", Fs: suite.fs})
+	suite.NoError(bucket.Open())
+	consumer, err := bucket.Consumer(context.Background(), "group")
+	suite.NoError(err)
+	_, err = consumer.NextRecord()
+	suite.True(errors.Is(err, ErrNotFramed))
+}
+
+func (suite *ConsumerTestSuite) consumer(group string) *Consumer {
+	consumer, err := suite.bucket.Consumer(context.Background(), group)
+	suite.NoError(err)
+	return consumer
+}
+
+func (suite *ConsumerTestSuite) assertRecords(consumer *Consumer, expected ...string) {
+	for _, e := range expected {
+		record, err := consumer.NextRecord()
+		suite.NoError(err)
+		suite.Equal(e, string(record))
+	}
+}
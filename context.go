@@ -0,0 +1,88 @@
+package buffer
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// lockContext acquires the given lock, unless the context is done first. Since
+// waiting on a lock cannot be interrupted, it is done in the background and
+// released again straight away if the caller has already given up.
+func lockContext(ctx context.Context, l sync.Locker) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if t, ok := l.(interface{ TryLock() bool }); ok && t.TryLock() {
+		return nil
+	}
+
+	locked := make(chan struct{})
+	go func() {
+		l.Lock()
+		close(locked)
+	}()
+
+	select {
+	case <-locked:
+		return nil
+	case <-ctx.Done():
+		go func() {
+			<-locked
+			l.Unlock()
+		}()
+		return ctx.Err()
+	}
+}
+
+// WriteContext is the same as Write, but gives up as soon as the context is
+// done while waiting for other writers. Once the data is being written to the
+// file, it will not be interrupted.
+func (b *Bucket) WriteContext(ctx context.Context, data ...[]byte) error {
+	data, err := b.prepare(data)
+	if err != nil {
+		return b.fail("write", err)
+	}
+
+	_, err = b.writeContext(ctx, data)
+	return err
+}
+
+// writeContext does the work for WriteContext once the data is prepared,
+// returning how many bytes of it were written.
+func (b *Bucket) writeContext(ctx context.Context, data [][]byte) (int, error) {
+	if err := lockContext(ctx, b); err != nil {
+		return 0, b.fail("write", err)
+	}
+	defer b.Unlock()
+
+	written, err := b.append(data)
+	return written, b.fail("write", err)
+}
+
+// ReadContext is the same as Read, but gives up as soon as the context is done
+// while waiting for other readers.
+func (b *Bucket) ReadContext(ctx context.Context, p []byte) (int, error) {
+	if err := lockContext(ctx, b); err != nil {
+		return 0, b.fail("read", err)
+	}
+	defer b.Unlock()
+
+	n, err := b.read(p)
+	return n, b.fail("read", err)
+}
+
+// ReaderContext wraps this bucket in an io.Reader that uses ReadContext, so it
+// can be passed to functions like io.Copy while still honouring the context.
+func (b *Bucket) ReaderContext(ctx context.Context) io.Reader {
+	return &contextReader{ctx: ctx, bucket: b}
+}
+
+type contextReader struct {
+	ctx    context.Context
+	bucket *Bucket
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	return r.bucket.ReadContext(r.ctx, p)
+}
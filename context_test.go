@@ -0,0 +1,88 @@
+package buffer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/suite"
+)
+
+type ContextTestSuite struct {
+	suite.Suite
+	buffer *Buffer
+	bucket *Bucket
+}
+
+func TestContextTestSuite(t *testing.T) {
+	suite.Run(t, new(ContextTestSuite))
+}
+
+func (suite *ContextTestSuite) SetupTest() {
+	suite.buffer = NewBuffer(BufferOptions{
+		Root: "./test",
+		Fs:   afero.NewMemMapFs(),
+	})
+	bucket, err := suite.buffer.Get("a")
+	suite.NoError(err)
+	suite.bucket = bucket
+}
+
+func (suite *ContextTestSuite) TestWriteContext() {
+	suite.NoError(suite.bucket.WriteContext(context.Background(), []byte("hello world")))
+	suite.EqualValues(1, suite.bucket.Writes())
+}
+
+func (suite *ContextTestSuite) TestWriteContextCanceled() {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	suite.True(errors.Is(suite.bucket.WriteContext(ctx, []byte("hello world")), context.Canceled))
+	suite.EqualValues(0, suite.bucket.Writes())
+}
+
+func (suite *ContextTestSuite) TestWriteContextLocked() {
+	suite.bucket.Lock()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	suite.True(errors.Is(suite.bucket.WriteContext(ctx, []byte("hello world")), context.DeadlineExceeded))
+	suite.bucket.Unlock()
+	suite.NoError(suite.bucket.Write([]byte("hello world")), "the lock is released again")
+	suite.EqualValues(1, suite.bucket.Writes())
+}
+
+func (suite *ContextTestSuite) TestReadContext() {
+	suite.NoError(suite.bucket.Write([]byte("hello world")))
+	suite.NoError(suite.bucket.Close())
+	var actual bytes.Buffer
+	_, err := io.Copy(&actual, suite.bucket.ReaderContext(context.Background()))
+	suite.NoError(err)
+	suite.Equal("hello world", actual.String())
+}
+
+func (suite *ContextTestSuite) TestReadContextCanceled() {
+	suite.NoError(suite.bucket.Close())
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := suite.bucket.ReadContext(ctx, make([]byte, 10))
+	suite.True(errors.Is(err, context.Canceled))
+}
+
+func (suite *ContextTestSuite) TestGetContextLocked() {
+	suite.buffer.Lock()
+	defer suite.buffer.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := suite.buffer.GetContext(ctx, "a")
+	suite.True(errors.Is(err, context.DeadlineExceeded))
+}
+
+func (suite *ContextTestSuite) TestBufferWriteContextCanceled() {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	suite.True(errors.Is(suite.buffer.WriteContext(ctx, "b", []byte("hello world")), context.Canceled))
+	suite.EqualValues(1, suite.buffer.Size())
+}
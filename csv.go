@@ -0,0 +1,250 @@
+package buffer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// errFramedCSV is returned when opening a CSV bucket that is also framed,
+// since the file would no longer be valid CSV.
+var errFramedCSV = errors.New("CSV buckets cannot be framed")
+
+// checkCSV makes sure the options for a CSV bucket make sense.
+func (b *Bucket) checkCSV() error {
+	if b.format != FormatCSV {
+		return nil
+	}
+	if len(b.header) == 0 {
+		return ErrNoHeader
+	}
+	if b.framed {
+		return errFramedCSV
+	}
+	return nil
+}
+
+// prepareCSV checks that the data is a single row with the right number of
+// columns, and converts it to a consistent form.
+func (b *Bucket) prepareCSV(data []byte) ([][]byte, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+
+	row, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("%w: no row", ErrInvalidCSV)
+	} else if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCSV, err)
+	}
+	if _, err := reader.Read(); err != io.EOF {
+		return nil, fmt.Errorf("%w: more than one row", ErrInvalidCSV)
+	}
+	if len(row) != len(b.header) {
+		return nil, fmt.Errorf("%w: row has %d columns, expected %d", ErrInvalidCSV, len(row), len(b.header))
+	}
+
+	line, err := csvLine(row)
+	if err != nil {
+		return nil, err
+	}
+	return [][]byte{line}, nil
+}
+
+// csvLine encodes a single row.
+func csvLine(row []string) ([]byte, error) {
+	var line bytes.Buffer
+	writer := csv.NewWriter(&line)
+	if err := writer.Write(row); err != nil {
+		return nil, err
+	}
+	writer.Flush()
+	return line.Bytes(), writer.Error()
+}
+
+// writeHeader starts a new file (or segment) with the header, the caller must
+// hold the lock. It counts towards Bytes, but not Writes.
+func (b *Bucket) writeHeader() error {
+	line, err := csvLine(b.header)
+	if err != nil {
+		return err
+	}
+
+	written, err := b.write([][]byte{line})
+	b.bytes += uint64(written)
+	b.segmentBytes += uint64(written)
+	return err
+}
+
+// WriteRow adds a single row to a bucket using FormatCSV. The header is added
+// automatically before the first row of each file.
+func (b *Bucket) WriteRow(row []string) error {
+	if b.format != FormatCSV {
+		return b.fail("write", ErrNotCSV)
+	}
+
+	line, err := csvLine(row)
+	if err != nil {
+		return b.fail("write", err)
+	}
+	return b.Write(line)
+}
+
+// Rows returns an independent reader for the rows of a bucket using FormatCSV,
+// which must be closed first like for Read. The header at the start of each
+// file is checked and skipped. Make sure to close the reader when done.
+func (b *Bucket) Rows() (rows *Rows, err error) {
+	b.RLock()
+	defer b.RUnlock()
+	defer b.wrap("read", &err)
+
+	if b.format != FormatCSV {
+		return nil, ErrNotCSV
+	}
+	if b.open {
+		return nil, ErrBucketNotSealed
+	}
+	if !b.started() {
+		return nil, ErrBucketNotOpen
+	}
+
+	rows = &Rows{bucket: b, segments: b.segment + 1}
+	if b.memory != nil {
+		rows.memory = b.memory.Bytes()
+	} else if rows.last, err = b.snapshot(); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// Rows reads the rows of a CSV bucket one at a time, eg:
+//
+//	rows, err := bucket.Rows()
+//	if err != nil {
+//		return err
+//	}
+//	defer rows.Close()
+//	for rows.Next() {
+//		fmt.Println(rows.Row())
+//	}
+//	if err := rows.Err(); err != nil {
+//		return err
+//	}
+type Rows struct {
+	bucket *Bucket
+	// what was held in memory when the reader was created, if anything,
+	// otherwise the last file as it was then
+	memory []byte
+	last   *snapshot
+	// each segment is read separately since they each have a header
+	segments int
+	segment  int
+	source   io.ReadCloser
+	reader   *csv.Reader
+	row      []string
+	err      error
+}
+
+// Next advances to the next row, returning false when there are no more or
+// something went wrong. (see Err)
+func (r *Rows) Next() bool {
+	for r.err == nil {
+		if r.reader == nil {
+			if r.segment >= r.segments {
+				r.err = io.EOF
+				break
+			}
+			r.err = r.bucket.fail("read", r.open())
+			continue
+		}
+
+		row, err := r.reader.Read()
+		if err == io.EOF {
+			r.err = r.bucket.fail("read", r.close())
+			continue
+		} else if err != nil {
+			r.err = r.bucket.fail("read", err)
+			break
+		}
+
+		r.row = row
+		return true
+	}
+	return false
+}
+
+// open starts reading the next segment, checking its header.
+func (r *Rows) open() error {
+	b := r.bucket
+	if r.memory != nil {
+		r.source = ioutil.NopCloser(bytes.NewReader(r.memory))
+	} else if b.segmented() {
+		segment := &multiSegmentReader{bucket: b, next: r.segment, count: r.segment + 1}
+		if r.segment == r.segments-1 {
+			segment.last = r.last
+		}
+		r.source = segment
+	} else {
+		source, err := b.sourceOf(1, r.last)
+		if err != nil {
+			return err
+		}
+		r.source = source
+	}
+	r.segment++
+
+	r.reader = csv.NewReader(r.source)
+	r.reader.FieldsPerRecord = len(b.header)
+
+	header, err := r.reader.Read()
+	if err == io.EOF {
+		// nothing was written to this file, not even the header
+		return r.close()
+	} else if err != nil {
+		return err
+	}
+	for n := range header {
+		if header[n] != b.header[n] {
+			return fmt.Errorf("header %q does not match %q", header, b.header)
+		}
+	}
+	return nil
+}
+
+// close finishes reading the current segment.
+func (r *Rows) close() error {
+	if r.source == nil {
+		return nil
+	}
+
+	err := r.source.Close()
+	r.source = nil
+	r.reader = nil
+	return err
+}
+
+// Row retrieves the current row, after Next has returned true.
+func (r *Rows) Row() []string {
+	return r.row
+}
+
+// Header retrieves the header of the bucket.
+func (r *Rows) Header() []string {
+	return r.bucket.header
+}
+
+// Err retrieves the error that stopped the reader, if any. Reaching the end of
+// the bucket is not an error.
+func (r *Rows) Err() error {
+	if r.err == io.EOF {
+		return nil
+	}
+	return r.err
+}
+
+// Close releases any file being read.
+func (r *Rows) Close() error {
+	return r.bucket.fail("read", r.close())
+}
@@ -0,0 +1,208 @@
+package buffer
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/suite"
+)
+
+type CSVTestSuite struct {
+	suite.Suite
+	fs afero.Fs
+}
+
+func TestCSVTestSuite(t *testing.T) {
+	suite.Run(t, new(CSVTestSuite))
+}
+
+func (suite *CSVTestSuite) SetupTest() {
+	suite.fs = afero.NewMemMapFs()
+}
+
+func (suite *CSVTestSuite) bucket(o BucketOptions) *Bucket {
+	o.Format = FormatCSV
+	if o.Header == nil {
+		o.Header = []string{"id", "name"}
+	}
+	return openBucket(suite.T(), suite.fs, o)
+}
+
+// rows reads every row from the bucket.
+func (suite *CSVTestSuite) rows(bucket *Bucket) [][]string {
+	rows, err := bucket.Rows()
+	suite.NoError(err)
+	defer rows.Close()
+
+	var list [][]string
+	for rows.Next() {
+		list = append(list, rows.Row())
+	}
+	suite.NoError(rows.Err())
+	return list
+}
+
+func (suite *CSVTestSuite) TestWriteRow() {
+	bucket := suite.bucket(BucketOptions{})
+	suite.NoError(bucket.WriteRow([]string{"1", "a"}))
+	suite.NoError(bucket.WriteRow([]string{"2", "b, \"c\"\nd"}))
+	suite.NoError(bucket.Write([]byte("3,e")))
+	suite.NoError(bucket.Close())
+
+	contents, err := afero.ReadFile(suite.fs, "./test/a")
+	suite.NoError(err)
+	suite.Equal("id,name\n1,a\n2,\"b, \"\"c\"\"\nd\"\n3,e\n", string(contents))
+	suite.Equal(uint(3), bucket.Writes())
+	suite.Equal(uint64(len(contents)), bucket.Bytes())
+
+	suite.Equal([][]string{{"1", "a"}, {"2", "b, \"c\"\nd"}, {"3", "e"}}, suite.rows(bucket))
+}
+
+func (suite *CSVTestSuite) TestInvalid() {
+	bucket := suite.bucket(BucketOptions{})
+	for data, message := range map[string]string{
+		"1":         "invalid CSV: row has 1 columns, expected 2",
+		"1,a,x":     "invalid CSV: row has 3 columns, expected 2",
+		"1,a\n2,b":  "invalid CSV: more than one row",
+		"":          "invalid CSV: no row",
+		"1,\"a":     "invalid CSV: parse error",
+		"1,a\"b\"c": "invalid CSV: parse error",
+	} {
+		err := bucket.Write([]byte(data))
+		suite.True(errors.Is(err, ErrInvalidCSV), data)
+		suite.Contains(err.Error(), "write ./test/a: "+message, data)
+	}
+	suite.True(errors.Is(bucket.WriteRow([]string{"1"}), ErrInvalidCSV))
+	suite.Equal(uint(0), bucket.Writes())
+	suite.Equal(uint64(0), bucket.Bytes())
+}
+
+func (suite *CSVTestSuite) TestConcurrent() {
+	bucket := suite.bucket(BucketOptions{})
+
+	var wg sync.WaitGroup
+	for n := 0; n < 10; n++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			suite.NoError(bucket.WriteRow([]string{strconv.Itoa(n), "x"}))
+		}(n)
+	}
+	wg.Wait()
+	suite.NoError(bucket.Close())
+
+	suite.Len(suite.rows(bucket), 10)
+}
+
+func (suite *CSVTestSuite) TestSegmented() {
+	bucket := suite.bucket(BucketOptions{MaxSegmentWrites: 2})
+	for n := 0; n < 5; n++ {
+		suite.NoError(bucket.WriteRow([]string{strconv.Itoa(n), "x"}))
+	}
+	suite.NoError(bucket.Close())
+
+	segments := bucket.Segments()
+	suite.Len(segments, 3)
+	for _, segment := range segments {
+		contents, err := afero.ReadFile(suite.fs, segment)
+		suite.NoError(err)
+		suite.Contains(string(contents), "id,name\n", segment)
+	}
+
+	rows := suite.rows(bucket)
+	suite.Len(rows, 5)
+	for n, row := range rows {
+		suite.Equal([]string{strconv.Itoa(n), "x"}, row)
+	}
+}
+
+func (suite *CSVTestSuite) TestReopen() {
+	bucket := suite.bucket(BucketOptions{Compression: "gzip"})
+	suite.NoError(bucket.WriteRow([]string{"1", "a"}))
+	suite.NoError(bucket.Close())
+	suite.NoError(bucket.Reopen())
+	suite.NoError(bucket.WriteRow([]string{"2", "b"}))
+	suite.NoError(bucket.Close())
+
+	suite.Equal([][]string{{"1", "a"}, {"2", "b"}}, suite.rows(bucket))
+}
+
+func (suite *CSVTestSuite) TestRecover() {
+	bucket := suite.bucket(BucketOptions{})
+	suite.NoError(bucket.WriteRow([]string{"1", "a"}))
+	suite.NoError(bucket.Close())
+
+	recovered := NewBucket(BucketOptions{Path: "./test/a", Fs: suite.fs, Format: FormatCSV, Header: []string{"id", "name"}})
+	suite.NoError(recovered.Recover())
+	suite.NoError(recovered.WriteRow([]string{"2", "b"}))
+	suite.NoError(recovered.Close())
+
+	contents, err := afero.ReadFile(suite.fs, "./test/a")
+	suite.NoError(err)
+	suite.Equal("id,name\n1,a\n2,b\n", string(contents))
+}
+
+func (suite *CSVTestSuite) TestMemory() {
+	bucket := suite.bucket(BucketOptions{SpillBytes: 100})
+	suite.NoError(bucket.WriteRow([]string{"1", "a"}))
+	suite.NoError(bucket.Close())
+
+	suite.Equal([][]string{{"1", "a"}}, suite.rows(bucket))
+}
+
+func (suite *CSVTestSuite) TestEmpty() {
+	bucket := suite.bucket(BucketOptions{})
+	suite.NoError(bucket.Close())
+
+	suite.Empty(suite.rows(bucket))
+}
+
+func (suite *CSVTestSuite) TestHeaderMismatch() {
+	suite.NoError(afero.WriteFile(suite.fs, "./test/a", []byte("id,title\n1,a\n"), 0644))
+	bucket := NewBucket(BucketOptions{Path: "./test/a", Fs: suite.fs, Format: FormatCSV, Header: []string{"id", "name"}})
+	suite.NoError(bucket.Recover())
+	suite.NoError(bucket.Close())
+
+	rows, err := bucket.Rows()
+	suite.NoError(err)
+	suite.False(rows.Next())
+	suite.EqualError(rows.Err(), `read ./test/a: header ["id" "title"] does not match ["id" "name"]`)
+	suite.NoError(rows.Close())
+}
+
+func (suite *CSVTestSuite) TestOptions() {
+	bucket := NewBucket(BucketOptions{Path: "./test/a", Fs: suite.fs, Format: FormatCSV})
+	suite.True(errors.Is(bucket.Open(), ErrNoHeader))
+
+	bucket = NewBucket(BucketOptions{Path: "./test/a", Fs: suite.fs, Format: FormatCSV, Header: []string{"a"}, Framed: true})
+	suite.EqualError(bucket.Open(), "open ./test/a: CSV buckets cannot be framed")
+}
+
+func (suite *CSVTestSuite) TestNotCSV() {
+	bucket := openBucket(suite.T(), suite.fs, BucketOptions{})
+	suite.True(errors.Is(bucket.WriteRow([]string{"a"}), ErrNotCSV))
+	suite.NoError(bucket.Close())
+	_, err := bucket.Rows()
+	suite.True(errors.Is(err, ErrNotCSV))
+
+	buffer := NewBuffer(BufferOptions{Root: "./test", Fs: suite.fs})
+	suite.True(errors.Is(buffer.WriteRow("a", []string{"a"}), ErrNotCSV))
+}
+
+func (suite *CSVTestSuite) TestBuffer() {
+	buffer := NewBuffer(BufferOptions{Root: "./test", Fs: suite.fs, Format: FormatCSV, Header: []string{"id", "name"}})
+	for n := 0; n < 3; n++ {
+		suite.NoError(buffer.WriteRow("a", []string{strconv.Itoa(n), fmt.Sprintf("name %d", n)}))
+	}
+	err := buffer.WriteRow("a", []string{"too", "many", "columns"})
+	suite.True(errors.Is(err, ErrInvalidCSV))
+	suite.NoError(buffer.Close())
+
+	bucket, err := buffer.Get("a")
+	suite.NoError(err)
+	suite.Len(suite.rows(bucket), 3)
+}
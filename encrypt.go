@@ -0,0 +1,432 @@
+package buffer
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrTampered is returned when reading an encrypted bucket file that fails
+// authentication, which means it was modified or truncated after being written.
+var ErrTampered = errors.New("encrypted bucket file failed authentication")
+
+// KeyProvider supplies the keys used to encrypt bucket files. Each key must be
+// 16, 24 or 32 bytes long to select AES-128, AES-192 or AES-256.
+type KeyProvider interface {
+	// CurrentKey retrieves the key that should be used to encrypt new files,
+	// along with the ID used to look it up again later.
+	CurrentKey() (id string, key []byte, err error)
+	// Key retrieves the key for decrypting a file that was encrypted using the
+	// given ID, allowing old keys to remain in use after rotating.
+	Key(id string) ([]byte, error)
+}
+
+// KeyRing is a simple KeyProvider backed by a map of IDs to keys.
+type KeyRing struct {
+	// the ID of the key used to encrypt new files
+	Current string
+	Keys    map[string][]byte
+}
+
+// CurrentKey implements KeyProvider.
+func (k KeyRing) CurrentKey() (string, []byte, error) {
+	key, err := k.Key(k.Current)
+	if err != nil {
+		return "", nil, err
+	}
+	return k.Current, key, nil
+}
+
+// Key implements KeyProvider.
+func (k KeyRing) Key(id string) ([]byte, error) {
+	key, ok := k.Keys[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", id)
+	}
+	return key, nil
+}
+
+// Encrypted files are made up of one or more sections, each beginning with a
+// header that records the key ID, followed by a series of chunks that are each
+// sealed with AES-GCM. The final chunk of each section is flagged, and each
+// chunk is tied to the position of its section, so that a section that was cut
+// short, removed or moved around can be detected. Once the file is finished, a
+// sealed trailer records how many sections there are, so that losing entire
+// sections from the end can be detected too. The trailer is removed again when
+// another section is added.
+const (
+	encryptMagic     = "GDBE"
+	encryptVersion   = 2
+	encryptChunkSize = 64 * 1024
+	encryptFinal     = 1 << 31
+	// marks the trailer, which cannot be mistaken for the length of a chunk
+	encryptTrailer = 1<<32 - 1
+	// the marker and the number of sections, followed by the GCM tag
+	encryptTrailerSize = 8 + 16
+	noncePrefixSize    = 8
+)
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptWriter buffers plaintext into chunks which are sealed and written to
+// the underlying writer as they fill up.
+type encryptWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	header  []byte
+	prefix  []byte
+	index   uint32
+	counter uint32
+	buf     []byte
+	// set once nothing else will be added to the file, so Close adds the
+	// trailer rather than leaving room for another section
+	last bool
+}
+
+// newEncryptWriter starts a new section, index is the number of sections that
+// are already in the file.
+func newEncryptWriter(w io.Writer, keys KeyProvider, index uint32) (*encryptWriter, error) {
+	id, key, err := keys.CurrentKey()
+	if err != nil {
+		return nil, err
+	}
+	if len(id) > 255 {
+		return nil, errors.New("key id cannot be longer than 255 bytes")
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := make([]byte, noncePrefixSize)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, err
+	}
+
+	header := []byte(encryptMagic)
+	header = append(header, encryptVersion, byte(len(id)))
+	header = append(header, id...)
+	header = append(header, prefix...)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+
+	return &encryptWriter{
+		w:      w,
+		aead:   aead,
+		header: header,
+		prefix: prefix,
+		index:  index,
+		buf:    make([]byte, 0, encryptChunkSize),
+	}, nil
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	var written int
+	for len(p) > 0 {
+		n := copy(e.buf[len(e.buf):cap(e.buf)], p)
+		e.buf = e.buf[:len(e.buf)+n]
+		written += n
+		p = p[n:]
+
+		if len(e.buf) == cap(e.buf) {
+			if err := e.seal(false); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// Flush seals whatever is currently buffered as a chunk.
+func (e *encryptWriter) Flush() error {
+	if len(e.buf) == 0 {
+		return nil
+	}
+	return e.seal(false)
+}
+
+// Close seals the final chunk, without it the file is considered truncated.
+// When this is the last section, the trailer is added after it.
+func (e *encryptWriter) Close() error {
+	if err := e.seal(true); err != nil {
+		return err
+	}
+	if !e.last {
+		return nil
+	}
+
+	count := e.index + 1
+	trailer := make([]byte, 8, encryptTrailerSize)
+	binary.BigEndian.PutUint32(trailer, encryptTrailer)
+	binary.BigEndian.PutUint32(trailer[4:], count)
+	trailer = e.aead.Seal(trailer, chunkNonce(e.prefix, e.counter), nil, trailerData(e.header, count))
+	_, err := e.w.Write(trailer)
+	return err
+}
+
+func (e *encryptWriter) seal(final bool) error {
+	nonce := chunkNonce(e.prefix, e.counter)
+	sealed := e.aead.Seal(nil, nonce, e.buf, chunkData(e.header, e.index, final))
+
+	length := uint32(len(sealed))
+	if final {
+		length |= encryptFinal
+	}
+	var header [4]byte
+	binary.BigEndian.PutUint32(header[:], length)
+	if _, err := e.w.Write(header[:]); err != nil {
+		return err
+	}
+	if _, err := e.w.Write(sealed); err != nil {
+		return err
+	}
+
+	e.counter++
+	e.buf = e.buf[:0]
+	return nil
+}
+
+// decryptReader reverses encryptWriter, authenticating each chunk as it goes.
+type decryptReader struct {
+	r        io.Reader
+	keys     KeyProvider
+	aead     cipher.AEAD
+	header   []byte
+	prefix   []byte
+	counter  uint32
+	sections uint32
+	final    bool
+	done     bool
+	plain    []byte
+}
+
+func newDecryptReader(r io.Reader, keys KeyProvider) *decryptReader {
+	return &decryptReader{r: r, keys: keys, final: true}
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if d.final {
+			if err := d.readNext(); err != nil {
+				return 0, err
+			}
+		} else if err := d.readChunk(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
+
+// readNext reads what comes after a section, which is either the header for
+// the next one or the trailer.
+func (d *decryptReader) readNext() error {
+	marker := make([]byte, len(encryptMagic))
+	if _, err := io.ReadFull(d.r, marker); err != nil {
+		return tampered(err)
+	}
+	if d.sections > 0 && binary.BigEndian.Uint32(marker) == encryptTrailer {
+		return d.readTrailer()
+	}
+	if string(marker) != encryptMagic {
+		return ErrTampered
+	}
+	return d.readHeader()
+}
+
+func (d *decryptReader) readHeader() error {
+	fixed := make([]byte, len(encryptMagic)+2)
+	copy(fixed, encryptMagic)
+	if _, err := io.ReadFull(d.r, fixed[len(encryptMagic):]); err != nil {
+		return tampered(err)
+	}
+	if version := fixed[len(encryptMagic)]; version != encryptVersion {
+		return fmt.Errorf("unsupported encryption version %d", version)
+	}
+
+	rest := make([]byte, int(fixed[len(encryptMagic)+1])+noncePrefixSize)
+	if _, err := io.ReadFull(d.r, rest); err != nil {
+		return tampered(err)
+	}
+	id := string(rest[:len(rest)-noncePrefixSize])
+
+	key, err := d.keys.Key(id)
+	if err != nil {
+		return err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+
+	d.aead = aead
+	d.header = append(fixed, rest...)
+	d.prefix = rest[len(rest)-noncePrefixSize:]
+	d.counter = 0
+	d.final = false
+	d.sections++
+	return nil
+}
+
+// readTrailer checks that the file has all of its sections, and that nothing
+// comes after them.
+func (d *decryptReader) readTrailer() error {
+	rest := make([]byte, encryptTrailerSize-len(encryptMagic))
+	if _, err := io.ReadFull(d.r, rest); err != nil {
+		return tampered(err)
+	}
+	count := binary.BigEndian.Uint32(rest)
+	if count != d.sections {
+		return ErrTampered
+	}
+	nonce := chunkNonce(d.prefix, d.counter)
+	if _, err := d.aead.Open(nil, nonce, rest[4:], trailerData(d.header, count)); err != nil {
+		return ErrTampered
+	}
+
+	var extra [1]byte
+	if _, err := io.ReadFull(d.r, extra[:]); err == nil {
+		return ErrTampered
+	} else if err != io.EOF {
+		return err
+	}
+
+	d.done = true
+	return nil
+}
+
+func (d *decryptReader) readChunk() error {
+	var header [4]byte
+	if _, err := io.ReadFull(d.r, header[:]); err != nil {
+		return tampered(err)
+	}
+	length := binary.BigEndian.Uint32(header[:])
+	final := length&encryptFinal != 0
+	length &^= encryptFinal
+	if length > encryptChunkSize+uint32(d.aead.Overhead()) {
+		return ErrTampered
+	}
+
+	sealed := make([]byte, length)
+	if _, err := io.ReadFull(d.r, sealed); err != nil {
+		return tampered(err)
+	}
+
+	nonce := chunkNonce(d.prefix, d.counter)
+	plain, err := d.aead.Open(sealed[:0], nonce, sealed, chunkData(d.header, d.sections-1, final))
+	if err != nil {
+		return ErrTampered
+	}
+
+	d.counter++
+	d.final = final
+	d.plain = plain
+	return nil
+}
+
+// tampered converts an unexpected end of file into ErrTampered, since the
+// writer always finishes with a final chunk and the trailer.
+func tampered(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrTampered
+	}
+	return err
+}
+
+func chunkNonce(prefix []byte, counter uint32) []byte {
+	nonce := make([]byte, noncePrefixSize+4)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[noncePrefixSize:], counter)
+	return nonce
+}
+
+// chunkData is the additional authenticated data for each chunk, it ties the
+// chunk to the section header, the position of the section in the file and to
+// whether it was meant to be the last chunk in the section.
+func chunkData(header []byte, index uint32, final bool) []byte {
+	data := make([]byte, len(header)+5)
+	copy(data, header)
+	binary.BigEndian.PutUint32(data[len(header):], index)
+	if final {
+		data[len(header)+4] = 1
+	}
+	return data
+}
+
+// trailerData is the additional authenticated data for the trailer, it ties
+// the number of sections to the header of the last one.
+func trailerData(header []byte, count uint32) []byte {
+	data := make([]byte, len(header)+8)
+	copy(data, header)
+	binary.BigEndian.PutUint32(data[len(header):], encryptTrailer)
+	binary.BigEndian.PutUint32(data[len(header)+4:], count)
+	return data
+}
+
+// unseal removes the trailer from the end of a finished file so that another
+// section can be added after the existing ones, the caller must hold the lock.
+func (b *Bucket) unseal() error {
+	size, err := b.file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if size < encryptTrailerSize {
+		return ErrTampered
+	}
+
+	trailer := make([]byte, encryptTrailerSize)
+	if _, err := b.file.ReadAt(trailer, size-encryptTrailerSize); err != nil {
+		return tampered(err)
+	}
+	if binary.BigEndian.Uint32(trailer) != encryptTrailer {
+		return ErrTampered
+	}
+
+	size -= encryptTrailerSize
+	if err := b.file.Truncate(size); err != nil {
+		return err
+	}
+	if _, err := b.file.Seek(size, io.SeekStart); err != nil {
+		return err
+	}
+
+	// the count is checked against the sections when the file is read
+	b.sections = binary.BigEndian.Uint32(trailer[4:])
+	b.disk -= encryptTrailerSize
+	return nil
+}
+
+// end marks the file as finished, so an encrypted file gets its trailer when
+// the writers are closed by finish. The caller must hold the lock.
+func (b *Bucket) end() error {
+	if b.keys == nil || b.memory != nil {
+		return nil
+	}
+
+	if b.writer == nil {
+		// the last section was already finished when the file was suspended,
+		// so the trailer goes after an empty one
+		if err := b.encode(b.file); err != nil {
+			return err
+		}
+	}
+	b.encrypter.last = true
+	return nil
+}
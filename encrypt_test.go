@@ -0,0 +1,214 @@
+package buffer
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/suite"
+)
+
+type EncryptTestSuite struct {
+	suite.Suite
+	fs   afero.Fs
+	keys KeyRing
+}
+
+func TestEncryptTestSuite(t *testing.T) {
+	suite.Run(t, new(EncryptTestSuite))
+}
+
+func (suite *EncryptTestSuite) SetupTest() {
+	suite.fs = afero.NewMemMapFs()
+	suite.keys = KeyRing{
+		Current: "a",
+		Keys: map[string][]byte{
+			"a": bytes.Repeat([]byte("a"), 32),
+			"b": bytes.Repeat([]byte("b"), 16),
+		},
+	}
+}
+
+func (suite *EncryptTestSuite) TestRoundTrip() {
+	bucket := suite.bucket(BucketOptions{})
+	data := []byte("hello world\n")
+	suite.NoError(bucket.Write(data))
+	suite.NoError(bucket.Close())
+	suite.assertNotContains(data)
+	actual, err := ioutil.ReadAll(bucket)
+	suite.NoError(err)
+	suite.Equal(data, actual)
+}
+
+func (suite *EncryptTestSuite) TestMultipleChunks() {
+	bucket := suite.bucket(BucketOptions{})
+	data := bytes.Repeat([]byte("hello world\n"), encryptChunkSize/4)
+	suite.NoError(bucket.Write(data))
+	suite.NoError(bucket.Close())
+	actual, err := ioutil.ReadAll(bucket)
+	suite.NoError(err)
+	suite.Equal(data, actual)
+}
+
+func (suite *EncryptTestSuite) TestEmpty() {
+	bucket := suite.bucket(BucketOptions{})
+	suite.NoError(bucket.Close())
+	actual, err := ioutil.ReadAll(bucket)
+	suite.NoError(err)
+	suite.Empty(actual)
+}
+
+func (suite *EncryptTestSuite) TestRotation() {
+	bucket := suite.bucket(BucketOptions{})
+	data := []byte("hello world\n")
+	suite.NoError(bucket.Write(data))
+	suite.NoError(bucket.Close())
+	bucket.keys = KeyRing{Current: "b", Keys: suite.keys.Keys}
+	suite.NoError(bucket.Close())
+	actual, err := ioutil.ReadAll(bucket)
+	suite.NoError(err)
+	suite.Equal(data, actual)
+}
+
+func (suite *EncryptTestSuite) TestUnknownKey() {
+	bucket := suite.bucket(BucketOptions{})
+	suite.NoError(bucket.Write([]byte("hello world\n")))
+	suite.NoError(bucket.Close())
+	delete(suite.keys.Keys, "a")
+	_, err := ioutil.ReadAll(bucket)
+	suite.EqualError(err, `read ./test/a: unknown key "a"`)
+}
+
+func (suite *EncryptTestSuite) TestTampered() {
+	bucket := suite.bucket(BucketOptions{})
+	suite.NoError(bucket.Write([]byte("hello world\n")))
+	suite.NoError(bucket.Close())
+	// flip the last byte, since overwriting it could leave it unchanged
+	last := make([]byte, 1)
+	_, err := bucket.file.ReadAt(last, int64(bucket.DiskBytes()-1))
+	suite.NoError(err)
+	_, err = bucket.file.WriteAt([]byte{^last[0]}, int64(bucket.DiskBytes()-1))
+	suite.NoError(err)
+	suite.NoError(bucket.Close())
+	_, err = ioutil.ReadAll(bucket)
+	suite.True(errors.Is(err, ErrTampered))
+}
+
+func (suite *EncryptTestSuite) TestTruncated() {
+	bucket := suite.bucket(BucketOptions{})
+	suite.NoError(bucket.Write(bytes.Repeat([]byte("hello world\n"), encryptChunkSize/4)))
+	suite.NoError(bucket.Close())
+	suite.NoError(bucket.file.Truncate(encryptChunkSize))
+	suite.NoError(bucket.Close())
+	_, err := ioutil.ReadAll(bucket)
+	suite.True(errors.Is(err, ErrTampered))
+}
+
+func (suite *EncryptTestSuite) TestInvalidKey() {
+	suite.keys.Keys["a"] = []byte("short")
+	bucket := NewBucket(BucketOptions{Path: "./test/a", Fs: suite.fs, Encryption: suite.keys})
+	suite.Error(bucket.Open())
+}
+
+func (suite *EncryptTestSuite) TestCompressedRecords() {
+	bucket := suite.bucket(BucketOptions{Checksum: true, Compression: "gzip"})
+	suite.NoError(bucket.Write([]byte("hello")))
+	suite.NoError(bucket.Write([]byte("world")))
+	suite.NoError(bucket.Close())
+	record, err := bucket.NextRecord()
+	suite.NoError(err)
+	suite.Equal("hello", string(record))
+	record, err = bucket.NextRecord()
+	suite.NoError(err)
+	suite.Equal("world", string(record))
+}
+
+func (suite *EncryptTestSuite) TestReopen() {
+	bucket := suite.bucket(BucketOptions{Framed: true, Compression: "gzip"})
+	suite.NoError(bucket.Write([]byte("hello")))
+	suite.NoError(bucket.Close())
+	suite.NoError(bucket.Reopen())
+	suite.NoError(bucket.Write([]byte("world")))
+	suite.NoError(bucket.Close())
+	suite.assertNotContains([]byte("world"))
+	for _, expected := range []string{"hello", "world"} {
+		record, err := bucket.NextRecord()
+		suite.NoError(err)
+		suite.Equal(expected, string(record))
+	}
+}
+
+func (suite *EncryptTestSuite) TestTruncatedSection() {
+	bucket := suite.bucket(BucketOptions{})
+	suite.NoError(bucket.Write([]byte("first")))
+	suite.NoError(bucket.Close())
+	size := suite.size()
+	suite.NoError(bucket.Reopen())
+	suite.NoError(bucket.Write([]byte("second")))
+	suite.NoError(bucket.Close())
+
+	actual, err := ioutil.ReadAll(bucket)
+	suite.NoError(err)
+	suite.Equal("firstsecond", string(actual))
+
+	// cutting off the whole second section leaves a file that looks finished
+	suite.NoError(bucket.file.Truncate(size))
+	suite.NoError(bucket.Close())
+	_, err = ioutil.ReadAll(bucket)
+	suite.True(errors.Is(err, ErrTampered))
+}
+
+func (suite *EncryptTestSuite) TestRemovedSection() {
+	bucket := suite.bucket(BucketOptions{})
+	var sizes []int64
+	for n, data := range []string{"first", "second", "third"} {
+		if n > 0 {
+			suite.NoError(bucket.Reopen())
+		}
+		suite.NoError(bucket.Write([]byte(data)))
+		suite.NoError(bucket.Close())
+		sizes = append(sizes, suite.size())
+	}
+
+	contents, err := afero.ReadFile(suite.fs, "./test/a")
+	suite.NoError(err)
+	start, end := sizes[0]-encryptTrailerSize, sizes[1]-encryptTrailerSize
+	contents = append(contents[:start:start], contents[end:]...)
+	suite.NoError(afero.WriteFile(suite.fs, "./test/a", contents, 0644))
+
+	reader, err := bucket.NewReader()
+	suite.NoError(err)
+	defer reader.Close()
+	_, err = ioutil.ReadAll(reader)
+	suite.True(errors.Is(err, ErrTampered))
+}
+
+func (suite *EncryptTestSuite) TestAppended() {
+	bucket := suite.bucket(BucketOptions{})
+	suite.NoError(bucket.Write([]byte("hello world\n")))
+	suite.NoError(bucket.Close())
+	_, err := bucket.file.WriteAt([]byte("extra"), suite.size())
+	suite.NoError(err)
+	suite.NoError(bucket.Close())
+	_, err = ioutil.ReadAll(bucket)
+	suite.True(errors.Is(err, ErrTampered))
+}
+
+func (suite *EncryptTestSuite) bucket(o BucketOptions) *Bucket {
+	o.Encryption = suite.keys
+	return openBucket(suite.T(), suite.fs, o)
+}
+
+func (suite *EncryptTestSuite) size() int64 {
+	info, err := suite.fs.Stat("./test/a")
+	suite.NoError(err)
+	return info.Size()
+}
+
+func (suite *EncryptTestSuite) assertNotContains(data []byte) {
+	contains, err := afero.FileContainsBytes(suite.fs, "./test/a", data)
+	suite.NoError(err)
+	suite.False(contains)
+}
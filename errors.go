@@ -0,0 +1,86 @@
+package buffer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var (
+	// ErrBucketOpen is returned when opening a bucket that is already open.
+	ErrBucketOpen = errors.New("bucket already open")
+	// ErrBucketNotOpen is returned when writing to or syncing a bucket that has
+	// not been opened yet.
+	ErrBucketNotOpen = errors.New("bucket not open, make sure to open it first")
+	// ErrBucketSealed is returned when writing to a bucket that has been
+	// closed, use Reopen to start accepting writes again.
+	ErrBucketSealed = errors.New("bucket sealed, it must be reopened before writing")
+	// ErrBucketNotSealed is returned when reading from a bucket that is still
+	// accepting writes.
+	ErrBucketNotSealed = errors.New("bucket accepting writes, make sure to close before reading")
+	// ErrBucketNotFound is returned by buffer operations on buckets that do not
+	// exist, for those that do not create them automatically.
+	ErrBucketNotFound = errors.New("bucket does not exist")
+	// ErrNotFramed is returned when asking for records from a bucket that is not
+	// framed.
+	ErrNotFramed = errors.New("bucket is not framed, records are not available")
+	// ErrNoPartitioner is returned by WriteKeyed when no partitioner is set.
+	ErrNoPartitioner = errors.New("buffer has no partitioner, make sure to set one in the options")
+	// ErrNotWindowed is returned by WriteAt when no window is set.
+	ErrNotWindowed = errors.New("buffer is not windowed, make sure to set a window in the options")
+	// ErrInvalidJSON is returned when writing something other than a single
+	// JSON value to a bucket using FormatNDJSON.
+	ErrInvalidJSON = errors.New("invalid JSON")
+	// ErrInvalidCSV is returned when writing something other than a single row
+	// with the right number of columns to a bucket using FormatCSV.
+	ErrInvalidCSV = errors.New("invalid CSV")
+	// ErrNotCSV is returned when using rows with a bucket that does not use
+	// FormatCSV.
+	ErrNotCSV = errors.New("bucket is not CSV, rows are not available")
+	// ErrNoHeader is returned when opening a bucket using FormatCSV without a
+	// header.
+	ErrNoHeader = errors.New("bucket has no header, make sure to set one in the options")
+)
+
+// BucketError records an error and the bucket operation that caused it. Use
+// errors.Is and errors.As to check for the underlying error, which may be one
+// of the errors above or come from the filesystem.
+type BucketError struct {
+	Op string
+	// the path of names used to get the bucket from its buffer, which is empty
+	// for a bucket created on its own
+	Name []string
+	Path string
+	Err  error
+}
+
+func (e *BucketError) Error() string {
+	if len(e.Name) == 0 {
+		return fmt.Sprintf("%s %s: %v", e.Op, e.Path, e.Err)
+	}
+	return fmt.Sprintf("%s bucket %q: %v", e.Op, strings.Join(e.Name, "/"), e.Err)
+}
+
+func (e *BucketError) Unwrap() error {
+	return e.Err
+}
+
+// fail wraps an error from the given operation on this bucket. Errors that are
+// already wrapped are left alone, as is io.EOF since readers must return it
+// as-is.
+func (b *Bucket) fail(op string, err error) error {
+	if err == nil || err == io.EOF {
+		return err
+	}
+	if _, ok := err.(*BucketError); ok {
+		return err
+	}
+	return &BucketError{Op: op, Name: b.name, Path: b.path, Err: err}
+}
+
+// wrap is the same as fail, but is deferred with a pointer to the named error
+// result of a method with several places it can fail.
+func (b *Bucket) wrap(op string, err *error) {
+	*err = b.fail(op, *err)
+}
@@ -0,0 +1,70 @@
+package buffer
+
+import (
+	"errors"
+	"io"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/suite"
+)
+
+type ErrorsTestSuite struct {
+	suite.Suite
+	fs afero.Fs
+}
+
+func TestErrorsTestSuite(t *testing.T) {
+	suite.Run(t, new(ErrorsTestSuite))
+}
+
+func (suite *ErrorsTestSuite) SetupTest() {
+	suite.fs = afero.NewMemMapFs()
+}
+
+func (suite *ErrorsTestSuite) TestBucket() {
+	bucket := NewBucket(BucketOptions{Path: "./test/a", Fs: suite.fs})
+	err := bucket.Write([]byte("hello"))
+	suite.EqualError(err, "write ./test/a: bucket not open, make sure to open it first")
+	var bucketErr *BucketError
+	suite.True(errors.As(err, &bucketErr))
+	suite.Equal(&BucketError{Op: "write", Path: "./test/a", Err: ErrBucketNotOpen}, bucketErr)
+	suite.True(errors.Is(err, ErrBucketNotOpen))
+}
+
+func (suite *ErrorsTestSuite) TestBuffer() {
+	buffer := NewBuffer(BufferOptions{Root: "./test", Fs: suite.fs})
+	suite.NoError(buffer.WritePath([]string{"a", "b"}, []byte("hello")))
+	suite.NoError(buffer.CloseTree("a"))
+	err := buffer.WritePath([]string{"a", "b"}, []byte("hello"))
+	suite.EqualError(err, `write bucket "a/b": bucket sealed, it must be reopened before writing`)
+	var bucketErr *BucketError
+	suite.True(errors.As(err, &bucketErr))
+	suite.Equal([]string{"a", "b"}, bucketErr.Name)
+	suite.Equal("test/a/b", bucketErr.Path)
+	suite.True(errors.Is(err, ErrBucketSealed))
+}
+
+func (suite *ErrorsTestSuite) TestFilesystem() {
+	bucket := NewBucket(BucketOptions{Path: "./test/a", Fs: afero.NewReadOnlyFs(suite.fs)})
+	err := bucket.Open()
+	var bucketErr *BucketError
+	suite.True(errors.As(err, &bucketErr))
+	suite.Equal("open", bucketErr.Op)
+	suite.True(errors.Is(err, syscall.EPERM))
+}
+
+func (suite *ErrorsTestSuite) TestRecoverMissing() {
+	bucket := NewBucket(BucketOptions{Path: "./test/a", Fs: suite.fs})
+	suite.True(errors.Is(bucket.Recover(), os.ErrNotExist))
+}
+
+func (suite *ErrorsTestSuite) TestEOF() {
+	bucket := NewBucket(BucketOptions{Path: "./test/a", Fs: suite.fs, Framed: true})
+	suite.NoError(bucket.Open())
+	suite.NoError(bucket.Close())
+	_, err := bucket.NextRecord()
+	suite.Equal(io.EOF, err)
+}
@@ -0,0 +1,143 @@
+package buffer
+
+import "sync"
+
+// EventType identifies what happened in an Event.
+type EventType int
+
+const (
+	// EventCreated is sent when a bucket is added to the buffer, either by
+	// writing to it for the first time or by recovering it.
+	EventCreated EventType = iota
+	// EventSealed is sent when a bucket is closed and stops accepting writes.
+	EventSealed
+	// EventDestroyed is sent when a bucket is deleted, the counters describe
+	// the bucket as it was right before.
+	EventDestroyed
+	// EventQuotaWarning is sent when usage goes past the QuotaWarning fraction
+	// of MaxBucketBytes for a bucket, or of MaxBytes for the whole buffer (in
+	// which case Name is empty and the counters are for the buffer).
+	EventQuotaWarning
+	// EventReopened is sent when a sealed bucket starts accepting writes again.
+	EventReopened
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventCreated:
+		return "created"
+	case EventSealed:
+		return "sealed"
+	case EventDestroyed:
+		return "destroyed"
+	case EventQuotaWarning:
+		return "quota warning"
+	case EventReopened:
+		return "reopened"
+	default:
+		return "unknown"
+	}
+}
+
+// Event describes something that happened to a buffer or one of its buckets.
+type Event struct {
+	Type   EventType
+	Name   []string
+	Path   string
+	Writes uint
+	Bytes  uint64
+}
+
+// Subscribe registers a function to be called with every event from now on,
+// until the returned function is called to unsubscribe. Events are delivered
+// in order from a separate goroutine, so the callback is free to call back into
+// the buffer, but a slow callback will hold up delivery to every subscriber.
+func (b *Buffer) Subscribe(fn func(Event)) (unsubscribe func()) {
+	return b.events.subscribe(fn)
+}
+
+// events delivers events to subscribers. Nothing is ever emitted while holding
+// on to a lock that a subscriber could need, instead events are queued and a
+// goroutine delivers them until the queue is empty.
+type events struct {
+	sync.Mutex
+	subscribers map[int]func(Event)
+	next        int
+	queue       []Event
+	delivering  bool
+}
+
+func newEvents() *events {
+	return &events{subscribers: make(map[int]func(Event))}
+}
+
+func (e *events) subscribe(fn func(Event)) func() {
+	e.Lock()
+	defer e.Unlock()
+
+	id := e.next
+	e.next++
+	e.subscribers[id] = fn
+
+	return func() {
+		e.Lock()
+		defer e.Unlock()
+
+		delete(e.subscribers, id)
+	}
+}
+
+// emit queues an event for delivery, it is safe to call with a nil receiver
+// for buckets that do not belong to a buffer.
+func (e *events) emit(event Event) {
+	if e == nil {
+		return
+	}
+
+	e.Lock()
+	defer e.Unlock()
+
+	if len(e.subscribers) == 0 {
+		return
+	}
+
+	e.queue = append(e.queue, event)
+	if !e.delivering {
+		e.delivering = true
+		go e.deliver()
+	}
+}
+
+func (e *events) deliver() {
+	for {
+		e.Lock()
+		if len(e.queue) == 0 {
+			e.delivering = false
+			e.Unlock()
+			return
+		}
+		event := e.queue[0]
+		e.queue = e.queue[1:]
+		subscribers := make([]func(Event), 0, len(e.subscribers))
+		for _, fn := range e.subscribers {
+			subscribers = append(subscribers, fn)
+		}
+		e.Unlock()
+
+		for _, fn := range subscribers {
+			fn(event)
+		}
+	}
+}
+
+// event describes the current state of this bucket, the caller must hold the
+// lock.
+func (b *Bucket) event(t EventType) Event {
+	return Event{
+		Type:   t,
+		Name:   b.name,
+		Path:   b.path,
+		Writes: b.writes,
+		Bytes:  b.bytes,
+	}
+}
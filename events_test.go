@@ -0,0 +1,157 @@
+package buffer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/suite"
+)
+
+type EventsTestSuite struct {
+	suite.Suite
+	options BufferOptions
+	events  chan Event
+}
+
+func TestEventsTestSuite(t *testing.T) {
+	suite.Run(t, new(EventsTestSuite))
+}
+
+func (suite *EventsTestSuite) SetupTest() {
+	suite.options = BufferOptions{
+		Root: "./test",
+		Fs:   afero.NewMemMapFs(),
+	}
+	suite.events = make(chan Event, 100)
+}
+
+func (suite *EventsTestSuite) subscribe(buffer *Buffer) func() {
+	events := suite.events
+	return buffer.Subscribe(func(e Event) {
+		events <- e
+	})
+}
+
+func (suite *EventsTestSuite) TestLifecycle() {
+	buffer := NewBuffer(suite.options)
+	suite.subscribe(buffer)
+	suite.NoError(buffer.Write("a", []byte("hello")))
+	suite.NoError(buffer.Write("a", []byte("world")))
+	suite.NoError(buffer.Close())
+	suite.NoError(buffer.DestroyBucket("a"))
+
+	suite.Equal(Event{Type: EventCreated, Name: []string{"a"}, Path: "test/a"}, suite.next())
+	suite.Equal(Event{Type: EventSealed, Name: []string{"a"}, Path: "test/a", Writes: 2, Bytes: 10}, suite.next())
+	suite.Equal(Event{Type: EventDestroyed, Name: []string{"a"}, Path: "test/a", Writes: 2, Bytes: 10}, suite.next())
+	suite.assertNone()
+}
+
+func (suite *EventsTestSuite) TestBucketClose() {
+	buffer := NewBuffer(suite.options)
+	suite.subscribe(buffer)
+	bucket, err := buffer.GetPath("x", "y")
+	suite.NoError(err)
+	suite.NoError(bucket.Close())
+	suite.NoError(bucket.Close())
+	suite.Equal(EventCreated, suite.next().Type)
+	e := suite.next()
+	suite.Equal(EventSealed, e.Type)
+	suite.Equal([]string{"x", "y"}, e.Name)
+	suite.Equal("test/x/y", e.Path)
+	suite.assertNone()
+}
+
+func (suite *EventsTestSuite) TestReset() {
+	buffer := NewBuffer(suite.options)
+	suite.NoError(buffer.Write("a", []byte("hello")))
+	suite.subscribe(buffer)
+	suite.NoError(buffer.Reset())
+	suite.Equal(EventDestroyed, suite.next().Type)
+	suite.assertNone()
+}
+
+func (suite *EventsTestSuite) TestRecover() {
+	suite.options.Framed = true
+	buffer := NewBuffer(suite.options)
+	suite.NoError(buffer.Write("a", []byte("hello")))
+	suite.options.Recover = true
+	recovered := NewBuffer(suite.options)
+	suite.subscribe(recovered)
+	suite.NoError(recovered.Open())
+	suite.Equal(Event{Type: EventCreated, Name: []string{"a"}, Path: "test/a", Writes: 1, Bytes: 5}, suite.next())
+}
+
+func (suite *EventsTestSuite) TestQuotaWarning() {
+	suite.options.MaxBytes = 76
+	suite.options.MaxBucketBytes = 20
+	suite.options.QuotaWarning = 0.5
+	buffer := NewBuffer(suite.options)
+	suite.subscribe(buffer)
+	suite.NoError(buffer.Write("a", make([]byte, 9)))
+	suite.NoError(buffer.Write("a", make([]byte, 1)))
+	suite.NoError(buffer.Write("a", make([]byte, 1)))
+	suite.Equal(EventCreated, suite.next().Type)
+	suite.Equal(Event{Type: EventQuotaWarning, Name: []string{"a"}, Path: "test/a", Writes: 2, Bytes: 10}, suite.next())
+	suite.assertNone()
+
+	for _, name := range []string{"b", "c", "d"} {
+		suite.NoError(buffer.Write(name, make([]byte, 9)))
+		suite.Equal(EventCreated, suite.next().Type)
+	}
+	suite.Equal(Event{Type: EventQuotaWarning, Path: "./test", Writes: 6, Bytes: 38}, suite.next())
+	suite.assertNone()
+}
+
+func (suite *EventsTestSuite) TestUnsubscribe() {
+	buffer := NewBuffer(suite.options)
+	unsubscribe := suite.subscribe(buffer)
+	suite.NoError(buffer.Write("a", []byte("hello")))
+	suite.Equal(EventCreated, suite.next().Type)
+	unsubscribe()
+	suite.NoError(buffer.Write("b", []byte("hello")))
+	suite.assertNone()
+}
+
+func (suite *EventsTestSuite) TestCallback() {
+	buffer := NewBuffer(suite.options)
+	events := suite.events
+	buffer.Subscribe(func(e Event) {
+		if e.Type == EventSealed {
+			suite.NoError(buffer.DestroyBucket(e.Name[0]))
+		}
+		events <- e
+	})
+	suite.NoError(buffer.Write("a", []byte("hello")))
+	suite.NoError(buffer.Close())
+	suite.Equal(EventCreated, suite.next().Type)
+	suite.Equal(EventSealed, suite.next().Type)
+	suite.Equal(EventDestroyed, suite.next().Type)
+	suite.EqualValues(0, buffer.Size())
+}
+
+func (suite *EventsTestSuite) TestEventTypeString() {
+	suite.Equal("created", EventCreated.String())
+	suite.Equal("sealed", EventSealed.String())
+	suite.Equal("destroyed", EventDestroyed.String())
+	suite.Equal("quota warning", EventQuotaWarning.String())
+	suite.Equal("reopened", EventReopened.String())
+}
+
+func (suite *EventsTestSuite) next() Event {
+	select {
+	case e := <-suite.events:
+		return e
+	case <-time.After(time.Second):
+		suite.FailNow("no event received")
+		return Event{}
+	}
+}
+
+func (suite *EventsTestSuite) assertNone() {
+	select {
+	case e := <-suite.events:
+		suite.Fail("unexpected event", "%+v", e)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
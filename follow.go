@@ -0,0 +1,190 @@
+package buffer
+
+import (
+	"bufio"
+	"context"
+	"io"
+
+	"github.com/spf13/afero"
+)
+
+// Follower reads a bucket while it is still being written, see Bucket.Follow.
+type Follower struct {
+	ctx     context.Context
+	bucket  *Bucket
+	segment int
+	file    afero.File
+	current io.Reader
+	reader  *bufio.Reader
+	records *recordReader
+}
+
+// Follow starts reading the bucket from the beginning while it may still be
+// accepting writes. Once the follower catches up, Read and NextRecord block
+// until more is written, returning io.EOF only after the bucket is sealed. The
+// context can be used to stop waiting, after which the follower cannot be used
+// any more.
+//
+// Data can only be read once it has reached the file, so anything held in
+// memory by WriteBuffer, compression or encryption shows up after it is
+// flushed. (see Sync and FlushInterval) A bucket held in memory because of
+// SpillBytes is spilled to disk straight away.
+func (b *Bucket) Follow(ctx context.Context) (*Follower, error) {
+	b.Lock()
+	defer b.Unlock()
+
+	if !b.started() {
+		return nil, b.fail("follow", ErrBucketNotOpen)
+	}
+
+	// followers read from the file, so anything held in memory goes there
+	if err := b.spill(); err != nil {
+		return nil, b.fail("follow", err)
+	}
+	b.ceiling.remove(b)
+
+	f := &Follower{ctx: ctx, bucket: b}
+	f.reader = bufio.NewReader(readerFunc(f.read))
+	f.records = &recordReader{r: f.reader, checksum: b.checksum}
+	return f, nil
+}
+
+// Read implements io.Reader, reading the same data as Bucket.Read.
+func (f *Follower) Read(p []byte) (int, error) {
+	n, err := f.reader.Read(p)
+	return n, f.bucket.fail("follow", err)
+}
+
+// NextRecord retrieves the next record from a framed bucket, waiting for it to
+// be written if needed. (see Bucket.NextRecord)
+func (f *Follower) NextRecord() ([]byte, error) {
+	if !f.bucket.framed {
+		return nil, f.bucket.fail("follow", ErrNotFramed)
+	}
+
+	record, err := f.records.next()
+	return record, f.bucket.fail("follow", err)
+}
+
+// Close releases the file being read.
+func (f *Follower) Close() error {
+	if f.file == nil {
+		return nil
+	}
+
+	err := f.file.Close()
+	f.file = nil
+	f.current = nil
+	return f.bucket.fail("follow", err)
+}
+
+// read decodes each segment in turn, moving on once the bucket has moved on to
+// writing the next one.
+func (f *Follower) read(p []byte) (int, error) {
+	for {
+		if f.current == nil {
+			if err := f.open(); err != nil {
+				return 0, err
+			}
+		}
+
+		n, err := f.current.Read(p)
+		if err != io.EOF {
+			return n, err
+		}
+
+		// the tail only gives up once there is nothing more for this segment
+		f.bucket.RLock()
+		last := f.segment >= f.bucket.segment
+		f.bucket.RUnlock()
+		if last {
+			return n, io.EOF
+		}
+
+		if err := f.Close(); err != nil {
+			return n, err
+		}
+		f.segment++
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+func (f *Follower) open() error {
+	path := f.bucket.path
+	if f.bucket.segmented() {
+		path = f.bucket.segmentPath(f.segment)
+	}
+
+	file, err := f.bucket.fs.Open(path)
+	if err != nil {
+		return err
+	}
+
+	reader, err := f.bucket.decode(&tail{follower: f, file: file, segment: f.segment})
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	f.file = file
+	f.current = reader
+	return nil
+}
+
+// tail reads a file that may still be growing, waiting for more to be written
+// whenever it reaches the end. Reaching the end only counts once the bucket
+// has been sealed or moved on to the next segment.
+type tail struct {
+	follower *Follower
+	file     afero.File
+	segment  int
+}
+
+func (t *tail) Read(p []byte) (int, error) {
+	b := t.follower.bucket
+	for {
+		// the channel is taken before reading, so nothing written in between
+		// can be missed
+		b.Lock()
+		changed := b.watch()
+		done := !b.open || t.segment < b.segment
+		b.Unlock()
+
+		n, err := t.file.Read(p)
+		if n > 0 || err != io.EOF || done {
+			return n, err
+		}
+
+		select {
+		case <-changed:
+		case <-t.follower.ctx.Done():
+			return 0, t.follower.ctx.Err()
+		}
+	}
+}
+
+// watch returns a channel that is closed the next time data reaches the file
+// or the state of the bucket changes, the caller must hold the lock.
+func (b *Bucket) watch() <-chan struct{} {
+	if b.changed == nil {
+		b.changed = make(chan struct{})
+	}
+	return b.changed
+}
+
+// notify wakes up any followers, the caller must hold the lock.
+func (b *Bucket) notify() {
+	if b.changed != nil {
+		close(b.changed)
+		b.changed = nil
+	}
+}
+
+// readerFunc adapts a function to io.Reader.
+type readerFunc func(p []byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) {
+	return f(p)
+}
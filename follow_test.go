@@ -0,0 +1,150 @@
+package buffer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/suite"
+)
+
+type FollowTestSuite struct {
+	suite.Suite
+	fs afero.Fs
+}
+
+func TestFollowTestSuite(t *testing.T) {
+	suite.Run(t, new(FollowTestSuite))
+}
+
+func (suite *FollowTestSuite) SetupTest() {
+	suite.fs = afero.NewMemMapFs()
+}
+
+func (suite *FollowTestSuite) TestNextRecord() {
+	for name, o := range suite.options() {
+		bucket := openBucket(suite.T(), suite.fs, o)
+		follower, err := bucket.Follow(context.Background())
+		suite.NoError(err, name)
+
+		done := make(chan error, 1)
+		go func() {
+			for i := 0; i < 5; i++ {
+				time.Sleep(time.Millisecond)
+				if err := bucket.Write([]byte(fmt.Sprint(i))); err != nil {
+					done <- err
+					return
+				}
+			}
+			done <- bucket.Close()
+		}()
+
+		for i := 0; i < 5; i++ {
+			record, err := follower.NextRecord()
+			suite.NoError(err, name)
+			suite.Equal(fmt.Sprint(i), string(record), name)
+		}
+		_, err = follower.NextRecord()
+		suite.Equal(io.EOF, err, name)
+		suite.NoError(follower.Close(), name)
+		suite.NoError(<-done, name)
+	}
+}
+
+func (suite *FollowTestSuite) TestRead() {
+	bucket := openBucket(suite.T(), suite.fs, BucketOptions{})
+	follower, err := bucket.Follow(context.Background())
+	suite.NoError(err)
+	suite.NoError(bucket.Write([]byte("hello ")))
+	p := make([]byte, 6)
+	_, err = io.ReadFull(follower, p)
+	suite.NoError(err)
+	suite.Equal("hello ", string(p))
+
+	done := make(chan error, 1)
+	go func() {
+		if err := bucket.Write([]byte("world")); err != nil {
+			done <- err
+			return
+		}
+		done <- bucket.Close()
+	}()
+	actual, err := ioutil.ReadAll(follower)
+	suite.NoError(err)
+	suite.Equal("world", string(actual))
+	suite.NoError(<-done)
+}
+
+func (suite *FollowTestSuite) TestSealed() {
+	bucket := openBucket(suite.T(), suite.fs, BucketOptions{Framed: true})
+	suite.NoError(bucket.Write([]byte("hello")))
+	suite.NoError(bucket.Close())
+	follower, err := bucket.Follow(context.Background())
+	suite.NoError(err)
+	record, err := follower.NextRecord()
+	suite.NoError(err)
+	suite.Equal("hello", string(record))
+	_, err = follower.NextRecord()
+	suite.Equal(io.EOF, err)
+}
+
+func (suite *FollowTestSuite) TestContext() {
+	bucket := openBucket(suite.T(), suite.fs, BucketOptions{Framed: true})
+	suite.NoError(bucket.Write([]byte("hello")))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	follower, err := bucket.Follow(ctx)
+	suite.NoError(err)
+	_, err = follower.NextRecord()
+	suite.NoError(err)
+	_, err = follower.NextRecord()
+	suite.True(errors.Is(err, context.DeadlineExceeded))
+}
+
+func (suite *FollowTestSuite) TestDestroy() {
+	bucket := openBucket(suite.T(), suite.fs, BucketOptions{Framed: true})
+	follower, err := bucket.Follow(context.Background())
+	suite.NoError(err)
+	done := make(chan error, 1)
+	go func() {
+		time.Sleep(time.Millisecond)
+		done <- bucket.Destroy()
+	}()
+	_, err = follower.NextRecord()
+	suite.Equal(io.EOF, err)
+	suite.NoError(<-done)
+}
+
+func (suite *FollowTestSuite) TestUnopened() {
+	bucket := NewBucket(BucketOptions{Path: "./test/a", Fs: suite.fs})
+	_, err := bucket.Follow(context.Background())
+	suite.True(errors.Is(err, ErrBucketNotOpen))
+}
+
+func (suite *FollowTestSuite) TestUnframed() {
+	bucket := openBucket(suite.T(), suite.fs, BucketOptions{})
+	follower, err := bucket.Follow(context.Background())
+	suite.NoError(err)
+	_, err = follower.NextRecord()
+	suite.True(errors.Is(err, ErrNotFramed))
+}
+
+func (suite *FollowTestSuite) options() map[string]BucketOptions {
+	return map[string]BucketOptions{
+		"plain":      {Framed: true},
+		"checksum":   {Checksum: true},
+		"segmented":  {Framed: true, MaxSegmentWrites: 2},
+		"compressed": {Framed: true, Compression: "gzip", Sync: SyncEveryWrite},
+		"buffered":   {Framed: true, WriteBuffer: 1024, FlushInterval: time.Millisecond},
+		"encrypted": {
+			Framed:     true,
+			Encryption: KeyRing{Current: "a", Keys: map[string][]byte{"a": make([]byte, 32)}},
+			Sync:       SyncEveryWrite,
+		},
+	}
+}
@@ -0,0 +1,167 @@
+package buffer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Format determines how the data in a bucket is laid out, which is enforced
+// when writing.
+type Format int
+
+const (
+	// FormatRaw stores data exactly as it is written.
+	FormatRaw Format = iota
+	// FormatNDJSON stores newline-delimited JSON. Each write must be a single
+	// JSON value, which is compacted onto one line and followed by a newline.
+	FormatNDJSON
+	// FormatCSV stores rows of comma-separated values, which requires a
+	// Header. Each write must be a single row with the same number of columns
+	// as the header, which is written at the start of every file. (or segment)
+	FormatCSV
+)
+
+// prepare checks and converts the data for a single write according to the
+// format of the bucket. It does not need the lock.
+func (b *Bucket) prepare(data [][]byte) ([][]byte, error) {
+	switch b.format {
+	case FormatNDJSON:
+		var line bytes.Buffer
+		if err := json.Compact(&line, bytes.Join(data, nil)); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidJSON, err)
+		}
+		line.WriteByte('\n')
+		return [][]byte{line.Bytes()}, nil
+	case FormatCSV:
+		return b.prepareCSV(bytes.Join(data, nil))
+	}
+
+	return data, nil
+}
+
+// LineError reports a problem with a single line (or record) in a bucket.
+type LineError struct {
+	Line int
+	Err  error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+// Lines returns an iterator for the lines in this bucket, which must be closed
+// first like for Read. It is meant for FormatNDJSON, so each line can be
+// decoded as JSON. When the bucket is framed, each record counts as a line.
+// Since the iterator reads from the bucket itself, only use one at a time and
+// don't mix it with calls to Read or NextRecord.
+func (b *Bucket) Lines() *Lines {
+	return &Lines{entries: newEntries(b)}
+}
+
+// Lines iterates over the lines in a bucket, eg:
+//
+//	lines := bucket.Lines()
+//	for lines.Next() {
+//		var event Event
+//		if err := lines.Decode(&event); err != nil {
+//			return err // includes the line number
+//		}
+//	}
+//	if err := lines.Err(); err != nil {
+//		return err
+//	}
+type Lines struct {
+	*entries
+	line []byte
+	err  error
+}
+
+// Next advances to the next line, returning false when there are no more or
+// something went wrong. (see Err)
+func (l *Lines) Next() bool {
+	if l.err != nil {
+		return false
+	}
+
+	line, err := l.next()
+	if err != nil {
+		l.err = err
+		return false
+	}
+
+	l.line = bytes.TrimSuffix(line, []byte("\n"))
+	return true
+}
+
+// Line retrieves the number of the current line, starting from 1.
+func (l *Lines) Line() int {
+	return l.count
+}
+
+// Bytes retrieves the current line, without the newline.
+func (l *Lines) Bytes() []byte {
+	return l.line
+}
+
+// Decode unmarshals the current line as JSON into v. Any error is reported as
+// a *LineError with the line number.
+func (l *Lines) Decode(v interface{}) error {
+	if err := json.Unmarshal(l.line, v); err != nil {
+		return l.bucket.fail("decode", &LineError{Line: l.count, Err: err})
+	}
+	return nil
+}
+
+// Err retrieves the error that stopped the iterator, if any. Reaching the end
+// of the bucket is not an error.
+func (l *Lines) Err() error {
+	if l.err == io.EOF {
+		return nil
+	}
+	return l.err
+}
+
+// entries reads a bucket one record at a time when it is framed, or one line
+// at a time otherwise.
+type entries struct {
+	bucket *Bucket
+	// only used when the bucket is not framed
+	lines *bufio.Reader
+	// how many have been read so far
+	count int
+}
+
+func newEntries(b *Bucket) *entries {
+	e := &entries{bucket: b}
+	if !b.framed {
+		e.lines = bufio.NewReader(b)
+	}
+	return e
+}
+
+func (e *entries) next() ([]byte, error) {
+	if e.lines == nil {
+		record, err := e.bucket.NextRecord()
+		if err == nil {
+			e.count++
+		}
+		return record, err
+	}
+
+	line, err := e.lines.ReadBytes('\n')
+	if err == io.EOF && len(line) > 0 {
+		// the last line is missing its newline
+		err = nil
+	}
+	if err == nil {
+		e.count++
+	}
+	return line, err
+}
@@ -0,0 +1,118 @@
+package buffer
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/suite"
+)
+
+type FormatTestSuite struct {
+	suite.Suite
+	fs afero.Fs
+}
+
+func TestFormatTestSuite(t *testing.T) {
+	suite.Run(t, new(FormatTestSuite))
+}
+
+func (suite *FormatTestSuite) SetupTest() {
+	suite.fs = afero.NewMemMapFs()
+}
+
+func (suite *FormatTestSuite) TestNDJSON() {
+	bucket := openBucket(suite.T(), suite.fs, BucketOptions{Format: FormatNDJSON})
+	suite.NoError(bucket.Write([]byte("{\n  \"a\": 1\n}")))
+	suite.NoError(bucket.Write([]byte(`"hello`), []byte(` world"`)))
+	suite.NoError(bucket.Write([]byte("[1, 2]\n")))
+	suite.NoError(bucket.Close())
+
+	contents, err := afero.ReadFile(suite.fs, "./test/a")
+	suite.NoError(err)
+	suite.Equal("{\"a\":1}\n\"hello world\"\n[1,2]\n", string(contents))
+	suite.Equal(uint(3), bucket.Writes())
+	suite.Equal(uint64(len(contents)), bucket.Bytes())
+}
+
+func (suite *FormatTestSuite) TestInvalidJSON() {
+	bucket := openBucket(suite.T(), suite.fs, BucketOptions{Format: FormatNDJSON})
+	for _, data := range []string{"", "nope", "{}{}", "1 2", "{\"a\":"} {
+		err := bucket.Write([]byte(data))
+		suite.True(errors.Is(err, ErrInvalidJSON), data)
+	}
+	suite.Equal(uint(0), bucket.Writes())
+	suite.Equal(uint64(0), bucket.Bytes())
+}
+
+func (suite *FormatTestSuite) TestQuota() {
+	buffer := NewBuffer(BufferOptions{Root: "./test", Fs: suite.fs, Format: FormatNDJSON, MaxBytes: 10})
+	err := buffer.Write("a", []byte("nope"))
+	suite.True(errors.Is(err, ErrInvalidJSON))
+
+	// the newline counts, the spaces that were removed don't
+	suite.NoError(buffer.Write("a", []byte(`[ 1, 2, 3 ]`)))
+	suite.Equal(uint64(8), buffer.Bytes())
+	suite.NoError(buffer.Write("a", []byte(`1`)))
+	suite.True(errors.Is(buffer.Write("a", []byte(`1`)), ErrQuotaExceeded))
+}
+
+func (suite *FormatTestSuite) TestLines() {
+	for name, o := range map[string]BucketOptions{
+		"plain":  {Format: FormatNDJSON},
+		"framed": {Format: FormatNDJSON, Checksum: true},
+	} {
+		suite.SetupTest()
+		bucket := openBucket(suite.T(), suite.fs, o)
+		suite.NoError(bucket.Write([]byte(`{"id":1}`)))
+		suite.NoError(bucket.Write([]byte(`{"id":2}`)))
+		suite.NoError(bucket.Close())
+
+		var ids, numbers []int
+		lines := bucket.Lines()
+		for lines.Next() {
+			var value struct{ ID int }
+			suite.NoError(lines.Decode(&value), name)
+			ids = append(ids, value.ID)
+			numbers = append(numbers, lines.Line())
+		}
+		suite.NoError(lines.Err(), name)
+		suite.Equal([]int{1, 2}, ids, name)
+		suite.Equal([]int{1, 2}, numbers, name)
+		suite.False(lines.Next(), name)
+	}
+}
+
+func (suite *FormatTestSuite) TestDecodeError() {
+	bucket := openBucket(suite.T(), suite.fs, BucketOptions{})
+	suite.NoError(bucket.Write([]byte("{\"id\":1}\n{\"id\":\n{\"id\":3}")))
+	suite.NoError(bucket.Close())
+
+	lines := bucket.Lines()
+	var value struct{ ID int }
+	suite.True(lines.Next())
+	suite.NoError(lines.Decode(&value))
+
+	suite.True(lines.Next())
+	suite.Equal(`{"id":`, string(lines.Bytes()))
+	err := lines.Decode(&value)
+	var lineErr *LineError
+	suite.True(errors.As(err, &lineErr))
+	suite.Equal(2, lineErr.Line)
+	suite.Contains(err.Error(), "decode ./test/a: line 2: ")
+
+	// the last line is read even without a newline
+	suite.True(lines.Next())
+	suite.NoError(lines.Decode(&value))
+	suite.Equal(3, value.ID)
+	suite.Equal(3, lines.Line())
+	suite.False(lines.Next())
+	suite.NoError(lines.Err())
+}
+
+func (suite *FormatTestSuite) TestNotSealed() {
+	bucket := openBucket(suite.T(), suite.fs, BucketOptions{Format: FormatNDJSON})
+	lines := bucket.Lines()
+	suite.False(lines.Next())
+	suite.True(errors.Is(lines.Err(), ErrBucketNotSealed))
+}
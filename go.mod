@@ -0,0 +1,15 @@
+module github.com/dominicbarnes/go-data-buffer
+
+go 1.18
+
+require (
+	github.com/spf13/afero v1.11.0
+	github.com/stretchr/testify v1.11.1
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	golang.org/x/text v0.14.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
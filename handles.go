@@ -0,0 +1,171 @@
+package buffer
+
+import (
+	"container/list"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// handles keeps the number of files held open by the buckets in a buffer
+// within a limit, by closing the least recently used ones. Buckets that are
+// busy are passed over, so the limit can be exceeded briefly while they are.
+type handles struct {
+	sync.Mutex
+	max      int
+	lru      *list.List
+	elements map[*Bucket]*list.Element
+}
+
+func newHandles(max int) *handles {
+	if max <= 0 {
+		return nil
+	}
+
+	return &handles{
+		max:      max,
+		lru:      list.New(),
+		elements: make(map[*Bucket]*list.Element),
+	}
+}
+
+// touch marks the bucket as the most recently used, closing others to make
+// room for it. The caller must hold the lock for the bucket.
+func (h *handles) touch(b *Bucket) {
+	h.Lock()
+	defer h.Unlock()
+
+	if e, ok := h.elements[b]; ok {
+		h.lru.MoveToFront(e)
+	} else {
+		h.elements[b] = h.lru.PushFront(b)
+	}
+
+	for e := h.lru.Back(); e != nil && h.lru.Len() > h.max; {
+		victim := e.Value.(*Bucket)
+		e = e.Prev()
+
+		if victim == b || !victim.TryLock() {
+			continue
+		}
+		if err := victim.suspend(); err != nil && victim.syncErr == nil {
+			// surfaced by the next write or close, like a background sync
+			victim.syncErr = err
+		}
+		victim.Unlock()
+		h.drop(victim)
+	}
+}
+
+// remove forgets about a bucket that no longer has a file open.
+func (h *handles) remove(b *Bucket) {
+	if h == nil {
+		return
+	}
+
+	h.Lock()
+	defer h.Unlock()
+
+	h.drop(b)
+}
+
+func (h *handles) drop(b *Bucket) {
+	if e, ok := h.elements[b]; ok {
+		h.lru.Remove(e)
+		delete(h.elements, b)
+	}
+}
+
+// started indicates whether the bucket has been opened, even if its file has
+// been closed for the time being to save a handle or it is still in memory.
+func (b *Bucket) started() bool {
+	return b.file != nil || b.suspended || b.memory != nil
+}
+
+// acquire makes sure the file is open before using it, the caller must hold
+// the lock.
+func (b *Bucket) acquire() error {
+	if b.suspended {
+		if err := b.revive(); err != nil {
+			return err
+		}
+	}
+	if b.handles != nil && b.file != nil {
+		b.handles.touch(b)
+	}
+	return nil
+}
+
+// suspend closes the file without changing anything else about the bucket,
+// so revive can pick up exactly where it left off. When writing, the chain of
+// writers is finished and a new stream is started by the next write.
+func (b *Bucket) suspend() error {
+	if b.file == nil {
+		return nil
+	}
+
+	if b.open {
+		if err := b.finish(); err != nil {
+			return err
+		}
+		b.writer = nil
+	} else if b.segments != nil {
+		if err := b.segments.Close(); err != nil {
+			return err
+		}
+	}
+
+	if err := b.file.Close(); err != nil {
+		return err
+	}
+
+	b.file = nil
+	b.suspended = true
+	return nil
+}
+
+// revive opens the file again after suspend.
+func (b *Bucket) revive() error {
+	path := b.path
+	if b.segmented() {
+		path = b.segmentPath(b.segment)
+	}
+
+	file, err := b.fs.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	b.file = file
+	b.suspended = false
+
+	if b.open {
+		_, err := file.Seek(0, io.SeekEnd)
+		return err
+	}
+
+	return b.reposition()
+}
+
+// reposition restores the position the bucket was being read from. A plain
+// file can seek straight there, otherwise it rewinds and reads back up to the
+// same position as before.
+func (b *Bucket) reposition() error {
+	consumed, offset, index := b.consumed, b.records.offset, b.records.index
+	if err := b.rewind(); err != nil {
+		return err
+	}
+	if b.plain() && !b.segmented() {
+		if _, err := b.file.Seek(consumed, io.SeekStart); err != nil {
+			return err
+		}
+		b.reader.Reset(b.file)
+		b.consumed = consumed
+	} else if _, err := io.CopyN(ioutil.Discard, readerFunc(b.consume), consumed); err != nil {
+		return err
+	}
+	b.records.offset = offset
+	b.records.index = index
+
+	return nil
+}
@@ -0,0 +1,282 @@
+package buffer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/suite"
+)
+
+type HandlesTestSuite struct {
+	suite.Suite
+	options BufferOptions
+}
+
+func TestHandlesTestSuite(t *testing.T) {
+	suite.Run(t, new(HandlesTestSuite))
+}
+
+func (suite *HandlesTestSuite) SetupTest() {
+	suite.options = BufferOptions{
+		Root:         "./test",
+		Fs:           afero.NewMemMapFs(),
+		MaxOpenFiles: 2,
+	}
+}
+
+// open counts the buckets that currently have a file open.
+func (suite *HandlesTestSuite) open(buffer *Buffer) int {
+	var count int
+	for _, bucket := range buffer.buckets {
+		if bucket.file != nil {
+			count++
+		}
+	}
+	return count
+}
+
+func (suite *HandlesTestSuite) TestWrite() {
+	buffer := NewBuffer(suite.options)
+	suite.NoError(buffer.Write("a", []byte("a1")))
+	suite.NoError(buffer.Write("b", []byte("b1")))
+	suite.Equal(2, suite.open(buffer))
+
+	suite.NoError(buffer.Write("c", []byte("c1")))
+	suite.Equal(2, suite.open(buffer))
+	suite.True(buffer.buckets["a"].suspended)
+
+	suite.NoError(buffer.Write("a", []byte("a2")))
+	suite.Equal(2, suite.open(buffer))
+	suite.True(buffer.buckets["b"].suspended)
+
+	suite.NoError(buffer.Close())
+	for name, expected := range map[string]string{"a": "a1a2", "b": "b1", "c": "c1"} {
+		bucket, err := buffer.Get(name)
+		suite.NoError(err)
+		data, err := ioutil.ReadAll(bucket)
+		suite.NoError(err)
+		suite.Equal(expected, string(data))
+	}
+}
+
+func (suite *HandlesTestSuite) TestEncoded() {
+	suite.options.Checksum = true
+	suite.options.Compression = "gzip"
+	suite.options.Encryption = KeyRing{Current: "a", Keys: map[string][]byte{"a": make([]byte, 32)}}
+	suite.options.WriteBuffer = 64
+	buffer := NewBuffer(suite.options)
+
+	names := []string{"a", "b", "c"}
+	for n := 0; n < 5; n++ {
+		for _, name := range names {
+			suite.NoError(buffer.Write(name, []byte(fmt.Sprintf("%s%d", name, n))))
+		}
+	}
+	suite.Equal(2, suite.open(buffer))
+	suite.NoError(buffer.Close())
+
+	for _, name := range names {
+		bucket, err := buffer.Get(name)
+		suite.NoError(err)
+		suite.Equal(uint(5), bucket.Writes())
+		for n := 0; n < 5; n++ {
+			record, err := bucket.NextRecord()
+			suite.NoError(err)
+			suite.Equal(fmt.Sprintf("%s%d", name, n), string(record))
+		}
+		_, err = bucket.NextRecord()
+		suite.Equal(io.EOF, err)
+	}
+}
+
+func (suite *HandlesTestSuite) TestSegmented() {
+	suite.options.Framed = true
+	suite.options.MaxSegmentWrites = 2
+	buffer := NewBuffer(suite.options)
+
+	for n := 0; n < 5; n++ {
+		for _, name := range []string{"a", "b", "c"} {
+			suite.NoError(buffer.Write(name, []byte(fmt.Sprintf("%s%d", name, n))))
+		}
+	}
+	suite.Equal(2, suite.open(buffer))
+
+	bucket, err := buffer.Get("a")
+	suite.NoError(err)
+	suite.Len(bucket.Segments(), 3)
+	suite.NoError(buffer.Close())
+
+	for n := 0; n < 5; n++ {
+		record, err := bucket.NextRecord()
+		suite.NoError(err)
+		suite.Equal(fmt.Sprintf("a%d", n), string(record))
+	}
+}
+
+func (suite *HandlesTestSuite) TestRead() {
+	suite.options.MaxSegmentBytes = 4
+	buffer := NewBuffer(suite.options)
+	suite.NoError(buffer.Write("a", []byte("hello"), []byte(" world")))
+	suite.NoError(buffer.Write("b", []byte("b")))
+	suite.NoError(buffer.Write("c", []byte("c")))
+	suite.NoError(buffer.Close())
+
+	a, err := buffer.Get("a")
+	suite.NoError(err)
+	data := make([]byte, 5)
+	_, err = io.ReadFull(a, data)
+	suite.NoError(err)
+	suite.Equal("hello", string(data))
+
+	// reading the others closes the file for the first one
+	for _, name := range []string{"b", "c"} {
+		bucket, err := buffer.Get(name)
+		suite.NoError(err)
+		_, err = ioutil.ReadAll(bucket)
+		suite.NoError(err)
+	}
+	suite.True(a.suspended)
+
+	rest, err := ioutil.ReadAll(a)
+	suite.NoError(err)
+	suite.Equal(" world", string(rest))
+	suite.False(a.suspended)
+}
+
+func (suite *HandlesTestSuite) TestReadSeek() {
+	buffer := NewBuffer(suite.options)
+	data := make([]byte, 10000)
+	for n := range data {
+		data[n] = byte(n)
+	}
+	suite.NoError(buffer.Write("a", data))
+	suite.NoError(buffer.Write("b", []byte("b")))
+	suite.NoError(buffer.Write("c", []byte("c")))
+	suite.NoError(buffer.Close())
+
+	a, err := buffer.Get("a")
+	suite.NoError(err)
+	first := make([]byte, 5000)
+	_, err = io.ReadFull(a, first)
+	suite.NoError(err)
+
+	for _, name := range []string{"b", "c"} {
+		bucket, err := buffer.Get(name)
+		suite.NoError(err)
+		_, err = ioutil.ReadAll(bucket)
+		suite.NoError(err)
+	}
+	suite.True(a.suspended)
+
+	// a plain file goes straight back to where it was, without reading
+	a.Lock()
+	suite.NoError(a.acquire())
+	pos, err := a.file.Seek(0, io.SeekCurrent)
+	a.Unlock()
+	suite.NoError(err)
+	suite.EqualValues(5000, pos)
+
+	rest, err := ioutil.ReadAll(a)
+	suite.NoError(err)
+	suite.Equal(data, append(first, rest...))
+}
+
+func (suite *HandlesTestSuite) TestRecords() {
+	suite.options.Checksum = true
+	buffer := NewBuffer(suite.options)
+	suite.NoError(buffer.Write("a", []byte("one")))
+	suite.NoError(buffer.Write("a", []byte("two")))
+	suite.NoError(buffer.Write("b", []byte("b")))
+	suite.NoError(buffer.Write("c", []byte("c")))
+	suite.NoError(buffer.Close())
+
+	a, err := buffer.Get("a")
+	suite.NoError(err)
+	record, err := a.NextRecord()
+	suite.NoError(err)
+	suite.Equal("one", string(record))
+
+	for _, name := range []string{"b", "c"} {
+		bucket, err := buffer.Get(name)
+		suite.NoError(err)
+		_, err = bucket.NextRecord()
+		suite.NoError(err)
+	}
+	suite.True(a.suspended)
+
+	record, err = a.NextRecord()
+	suite.NoError(err)
+	suite.Equal("two", string(record))
+	_, err = a.NextRecord()
+	suite.Equal(io.EOF, err)
+}
+
+func (suite *HandlesTestSuite) TestSealed() {
+	buffer := NewBuffer(suite.options)
+	suite.NoError(buffer.Write("a", []byte("a")))
+	suite.NoError(buffer.Write("b", []byte("b")))
+	suite.NoError(buffer.Write("c", []byte("c")))
+	suite.NoError(buffer.CloseBucket("a"))
+
+	err := buffer.buckets["a"].Write([]byte("nope"))
+	suite.Error(err)
+	suite.True(errors.Is(err, ErrBucketSealed))
+
+	suite.NoError(buffer.ReopenBucket("a"))
+	suite.NoError(buffer.Write("a", []byte("a")))
+	suite.NoError(buffer.Close())
+
+	bucket, err := buffer.Get("a")
+	suite.NoError(err)
+	data, err := ioutil.ReadAll(bucket)
+	suite.NoError(err)
+	suite.Equal("aa", string(data))
+}
+
+func (suite *HandlesTestSuite) TestDestroy() {
+	buffer := NewBuffer(suite.options)
+	suite.NoError(buffer.Write("a", []byte("a")))
+	suite.NoError(buffer.Write("b", []byte("b")))
+	suite.NoError(buffer.Write("c", []byte("c")))
+	suite.NoError(buffer.DestroyBucket("a"))
+	suite.NoError(buffer.DestroyBucket("b"))
+	suite.Equal(1, buffer.handles.lru.Len())
+
+	suite.NoError(buffer.Write("d", []byte("d")))
+	suite.Equal(2, suite.open(buffer))
+}
+
+func (suite *HandlesTestSuite) TestRecover() {
+	buffer := NewBuffer(suite.options)
+	for _, name := range []string{"a", "b", "c"} {
+		suite.NoError(buffer.Write(name, []byte(name)))
+	}
+	suite.NoError(buffer.Close())
+
+	suite.options.Recover = true
+	recovered := NewBuffer(suite.options)
+	suite.NoError(recovered.Open())
+	suite.Equal(2, suite.open(recovered))
+	suite.NoError(recovered.Write("a", []byte("a")))
+	suite.NoError(recovered.Close())
+
+	bucket, err := recovered.Get("a")
+	suite.NoError(err)
+	data, err := ioutil.ReadAll(bucket)
+	suite.NoError(err)
+	suite.Equal("aa", string(data))
+}
+
+func (suite *HandlesTestSuite) TestUnlimited() {
+	suite.options.MaxOpenFiles = 0
+	buffer := NewBuffer(suite.options)
+	for _, name := range []string{"a", "b", "c"} {
+		suite.NoError(buffer.Write(name, []byte(name)))
+	}
+	suite.Equal(3, suite.open(buffer))
+	suite.Nil(buffer.handles)
+}
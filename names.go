@@ -0,0 +1,96 @@
+package buffer
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// maxNameLength is the longest file name allowed by most filesystems (255),
+// less what is added for the hidden files kept next to a bucket, such as
+// "."+name+".recover" and "."+name+".offsets".
+const maxNameLength = 255 - len(".") - len(".recover")
+
+// NameMapper converts bucket names into the file names used on disk and back
+// again, so that arbitrary names can be used safely.
+type NameMapper interface {
+	// Path converts a bucket name into a file name, it must not contain any
+	// path separators and must not start with a "." as those are reserved.
+	Path(name string) (string, error)
+	// Name reverses Path, returning an error for anything Path would never
+	// have produced.
+	Name(path string) (string, error)
+}
+
+// InvalidNameError is returned when a bucket name (or a file that should
+// contain a bucket) cannot be used.
+type InvalidNameError struct {
+	Name   string
+	Reason string
+}
+
+func (e *InvalidNameError) Error() string {
+	return fmt.Sprintf("invalid bucket name %q: %s", e.Name, e.Reason)
+}
+
+// EscapeMapper is the default NameMapper. Lower-case letters, digits, "-", "_"
+// and "." are left alone, while any other byte is percent-encoded, as is a
+// leading ".". Upper-case letters are encoded too, so names that only differ
+// by case still get separate files on case-insensitive filesystems.
+// Names cannot be empty and must be no longer than 246 bytes once escaped.
+type EscapeMapper struct{}
+
+// Path implements NameMapper.
+func (EscapeMapper) Path(name string) (string, error) {
+	if name == "" {
+		return "", &InvalidNameError{Name: name, Reason: "cannot be empty"}
+	}
+
+	var path strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if safe(c) && !(i == 0 && c == '.') {
+			path.WriteByte(c)
+		} else {
+			fmt.Fprintf(&path, "%%%02X", c)
+		}
+	}
+
+	if path.Len() > maxNameLength {
+		return "", &InvalidNameError{Name: name, Reason: "too long"}
+	}
+	return path.String(), nil
+}
+
+// Name implements NameMapper.
+func (m EscapeMapper) Name(path string) (string, error) {
+	var name strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if c != '%' {
+			name.WriteByte(c)
+			continue
+		}
+
+		if i+2 >= len(path) {
+			return "", &InvalidNameError{Name: path, Reason: "invalid escape sequence"}
+		}
+		decoded, err := hex.DecodeString(path[i+1 : i+3])
+		if err != nil {
+			return "", &InvalidNameError{Name: path, Reason: "invalid escape sequence"}
+		}
+		name.Write(decoded)
+		i += 2
+	}
+
+	// only accept the canonical form, so each bucket has exactly one file
+	if escaped, err := m.Path(name.String()); err != nil || escaped != path {
+		return "", &InvalidNameError{Name: path, Reason: "not an escaped bucket name"}
+	}
+	return name.String(), nil
+}
+
+func safe(c byte) bool {
+	return 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '_' || c == '.'
+}
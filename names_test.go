@@ -0,0 +1,170 @@
+package buffer
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/suite"
+)
+
+type NamesTestSuite struct {
+	suite.Suite
+	mapper EscapeMapper
+}
+
+func TestNamesTestSuite(t *testing.T) {
+	suite.Run(t, new(NamesTestSuite))
+}
+
+func (suite *NamesTestSuite) TestPath() {
+	for name, expected := range map[string]string{
+		"simple":       "simple",
+		"data.json":    "data.json",
+		"a-b_c":        "a-b_c",
+		"../../etc/x":  "%2E.%2F..%2Fetc%2Fx",
+		".hidden":      "%2Ehidden",
+		"..":           "%2E.",
+		"a b":          "a%20b",
+		"a/b\\c":       "a%2Fb%5Cc",
+		"café":         "caf%C3%A9",
+		"Acme":         "%41cme",
+		"100%":         "100%25",
+		"with\x00null": "with%00null",
+	} {
+		actual, err := suite.mapper.Path(name)
+		suite.NoError(err, name)
+		suite.Equal(expected, actual, name)
+	}
+}
+
+func (suite *NamesTestSuite) TestPathInvalid() {
+	_, err := suite.mapper.Path("")
+	suite.Equal(&InvalidNameError{Name: "", Reason: "cannot be empty"}, err)
+	long := strings.Repeat("/", 100)
+	_, err = suite.mapper.Path(long)
+	suite.Equal(&InvalidNameError{Name: long, Reason: "too long"}, err)
+}
+
+func (suite *NamesTestSuite) TestLongest() {
+	dir, err := ioutil.TempDir("", "go-data-buffer")
+	suite.Require().NoError(err)
+	defer os.RemoveAll(dir)
+
+	// the hidden files next to the bucket need to fit on a real filesystem too
+	name := strings.Repeat("a", maxNameLength)
+	o := BufferOptions{Root: dir, Fs: afero.NewOsFs(), Compression: "gzip"}
+	buffer := NewBuffer(o)
+	suite.NoError(buffer.Write(name, []byte("hello world")))
+	suite.IsType(&InvalidNameError{}, buffer.Write(name+"a", []byte("hello world")))
+	suite.NoError(buffer.Close())
+
+	bucket, err := buffer.Get(name)
+	suite.NoError(err)
+	consumer, err := bucket.Consumer(context.Background(), name)
+	suite.NoError(err)
+	_, err = io.ReadFull(consumer, make([]byte, 5))
+	suite.NoError(err)
+	suite.NoError(consumer.Commit())
+
+	// cut into the compressed data, so recovery has to rewrite the file
+	path := filepath.Join(dir, name)
+	info, err := os.Stat(path)
+	suite.NoError(err)
+	suite.NoError(os.Truncate(path, info.Size()-4))
+	o.Recover = true
+	recovered := NewBuffer(o)
+	suite.NoError(recovered.Open())
+	suite.Equal([]string{name}, recovered.Buckets())
+	suite.NoError(recovered.Destroy())
+}
+
+func (suite *NamesTestSuite) TestName() {
+	for _, name := range []string{"simple", "../../etc/x", ".hidden", "a b", "café", "100%", "Acme"} {
+		path, err := suite.mapper.Path(name)
+		suite.NoError(err)
+		actual, err := suite.mapper.Name(path)
+		suite.NoError(err)
+		suite.Equal(name, actual)
+	}
+}
+
+func (suite *NamesTestSuite) TestNameInvalid() {
+	for _, path := range []string{"a%2", "a%zz", "a%2f", "a b", ".hidden", "a%61", "A"} {
+		_, err := suite.mapper.Name(path)
+		suite.IsType(&InvalidNameError{}, err, path)
+	}
+}
+
+func (suite *NamesTestSuite) TestBuffer() {
+	fs := afero.NewMemMapFs()
+	buffer := NewBuffer(BufferOptions{Root: "./test/root", Fs: fs})
+	suite.NoError(buffer.Write("../escape", []byte("hello world")))
+	exists, err := afero.Exists(fs, "./test/escape")
+	suite.NoError(err)
+	suite.False(exists)
+	exists, err = afero.Exists(fs, "./test/root/%2E.%2Fescape")
+	suite.NoError(err)
+	suite.True(exists)
+	suite.Equal([]string{"../escape"}, buffer.Buckets())
+}
+
+func (suite *NamesTestSuite) TestBufferCase() {
+	fs := afero.NewMemMapFs()
+	buffer := NewBuffer(BufferOptions{Root: "./test", Fs: fs})
+	suite.NoError(buffer.Write("Acme", []byte("hello")))
+	suite.NoError(buffer.Write("acme", []byte("world")))
+	for path, expected := range map[string]string{"./test/%41cme": "hello", "./test/acme": "world"} {
+		contents, err := afero.ReadFile(fs, path)
+		suite.NoError(err, path)
+		suite.Equal(expected, string(contents), path)
+	}
+}
+
+func (suite *NamesTestSuite) TestBufferInvalid() {
+	buffer := NewBuffer(BufferOptions{Root: "./test", Fs: afero.NewMemMapFs()})
+	suite.IsType(&InvalidNameError{}, buffer.Write("", []byte("hello world")))
+	suite.EqualValues(0, buffer.Size())
+}
+
+func (suite *NamesTestSuite) TestRecover() {
+	o := BufferOptions{Root: "./test", Fs: afero.NewMemMapFs()}
+	buffer := NewBuffer(o)
+	suite.NoError(buffer.Write("a/b", []byte("hello world")))
+	suite.NoError(buffer.Close())
+	o.Recover = true
+	recovered := NewBuffer(o)
+	suite.NoError(recovered.Open())
+	suite.Equal([]string{"a/b"}, recovered.Buckets())
+}
+
+func (suite *NamesTestSuite) TestRecoverInvalid() {
+	o := BufferOptions{Root: "./test", Fs: afero.NewMemMapFs(), Recover: true}
+	suite.NoError(afero.WriteFile(o.Fs, "./test/a b", []byte("hello world"), 0644))
+	buffer := NewBuffer(o)
+	suite.IsType(&InvalidNameError{}, buffer.Open())
+}
+
+func (suite *NamesTestSuite) TestCustomMapper() {
+	fs := afero.NewMemMapFs()
+	buffer := NewBuffer(BufferOptions{Root: "./test", Fs: fs, Names: prefixMapper{}})
+	suite.NoError(buffer.Write("a", []byte("hello world")))
+	exists, err := afero.Exists(fs, "./test/bucket-a")
+	suite.NoError(err)
+	suite.True(exists)
+}
+
+type prefixMapper struct{}
+
+func (prefixMapper) Path(name string) (string, error) {
+	return "bucket-" + name, nil
+}
+
+func (prefixMapper) Name(path string) (string, error) {
+	return strings.TrimPrefix(path, "bucket-"), nil
+}
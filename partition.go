@@ -0,0 +1,149 @@
+package buffer
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Partitioner decides which bucket a write belongs to, so that routing logic
+// lives in one place instead of at every call site (see Buffer.WriteKeyed).
+// The path returned can have several names to use a nested bucket.
+type Partitioner interface {
+	Partition(key string, data [][]byte) ([]string, error)
+}
+
+// HashPartitioner spreads keys evenly across a fixed number of buckets, named
+// "0" through "N-1", using an FNV-1a hash of the key.
+type HashPartitioner struct {
+	Partitions uint32
+}
+
+// Partition implements Partitioner.
+func (p HashPartitioner) Partition(key string, data [][]byte) ([]string, error) {
+	if p.Partitions == 0 {
+		return nil, fmt.Errorf("hash partitioner needs at least 1 partition")
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return []string{strconv.FormatUint(uint64(h.Sum32()%p.Partitions), 10)}, nil
+}
+
+// RangePartitioner assigns keys to buckets by comparing them against a sorted
+// list of bounds, each of which starts a new bucket. Keys below the first bound
+// go in bucket "0", keys from the first bound up to the second go in bucket "1"
+// and so on. Names can be set to use something other than the index, there
+// must be exactly one more name than there are bounds.
+type RangePartitioner struct {
+	Bounds []string
+	Names  []string
+}
+
+// Partition implements Partitioner.
+func (p RangePartitioner) Partition(key string, data [][]byte) ([]string, error) {
+	i := sort.Search(len(p.Bounds), func(i int) bool {
+		return p.Bounds[i] > key
+	})
+
+	if p.Names == nil {
+		return []string{strconv.Itoa(i)}, nil
+	} else if len(p.Names) != len(p.Bounds)+1 {
+		return nil, fmt.Errorf("range partitioner has %d bounds but %d names", len(p.Bounds), len(p.Names))
+	}
+	return []string{p.Names[i]}, nil
+}
+
+// TimePartitioner groups writes into buckets covering a fixed window of time,
+// based on a timestamp in the key. When the key is empty, the current time is
+// used instead.
+type TimePartitioner struct {
+	// the size of each window (defaults to 1 hour)
+	Window time.Duration
+	// the layout used to parse keys (defaults to time.RFC3339)
+	Layout string
+	// the layout used to name buckets after the start of their window, which is
+	// always in UTC (defaults to "20060102T150405Z")
+	Format string
+}
+
+// Partition implements Partitioner.
+func (p TimePartitioner) Partition(key string, data [][]byte) ([]string, error) {
+	window, layout, format := p.Window, p.Layout, p.Format
+	if window <= 0 {
+		window = time.Hour
+	}
+	if layout == "" {
+		layout = time.RFC3339
+	}
+	if format == "" {
+		format = defaultWindowFormat
+	}
+
+	t := time.Now()
+	if key != "" {
+		parsed, err := time.Parse(layout, key)
+		if err != nil {
+			return nil, err
+		}
+		t = parsed
+	}
+
+	return []string{t.UTC().Truncate(window).Format(format)}, nil
+}
+
+// FieldPartitioner takes the key from a field in the data itself, which must
+// be a JSON object (only the first chunk of each write is used). The field can
+// refer to nested objects by separating names with a ".", eg: "user.id". The
+// key given to WriteKeyed is ignored.
+type FieldPartitioner struct {
+	Field string
+	// the partitioner to pass the extracted key to, when this is nil the value
+	// of the field is used as the bucket name directly
+	Then Partitioner
+}
+
+// Partition implements Partitioner.
+func (p FieldPartitioner) Partition(key string, data [][]byte) ([]string, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("field partitioner needs data to extract %q from", p.Field)
+	}
+
+	value, err := extractField(data[0], p.Field)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.Then == nil {
+		return []string{value}, nil
+	}
+	return p.Then.Partition(value, data)
+}
+
+// extractField finds a field in a JSON object, strings are returned without
+// quotes while any other value is returned as-is.
+func extractField(data []byte, field string) (string, error) {
+	raw := json.RawMessage(data)
+	for _, name := range strings.Split(field, ".") {
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &object); err != nil {
+			return "", err
+		}
+
+		value, ok := object[name]
+		if !ok {
+			return "", fmt.Errorf("field %q not found", field)
+		}
+		raw = value
+	}
+
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s, nil
+	}
+	return string(raw), nil
+}
@@ -0,0 +1,157 @@
+package buffer
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/suite"
+)
+
+type PartitionTestSuite struct {
+	suite.Suite
+}
+
+func TestPartitionTestSuite(t *testing.T) {
+	suite.Run(t, new(PartitionTestSuite))
+}
+
+func (suite *PartitionTestSuite) TestHash() {
+	p := HashPartitioner{Partitions: 4}
+	seen := make(map[string]bool)
+	for _, key := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		path, err := p.Partition(key, nil)
+		suite.NoError(err)
+		suite.Len(path, 1)
+		suite.Contains([]string{"0", "1", "2", "3"}, path[0])
+		seen[path[0]] = true
+		again, err := p.Partition(key, nil)
+		suite.NoError(err)
+		suite.Equal(path, again)
+	}
+	suite.True(len(seen) > 1)
+}
+
+func (suite *PartitionTestSuite) TestHashNoPartitions() {
+	_, err := HashPartitioner{}.Partition("a", nil)
+	suite.Error(err)
+}
+
+func (suite *PartitionTestSuite) TestRange() {
+	p := RangePartitioner{Bounds: []string{"g", "p"}}
+	for key, expected := range map[string]string{
+		"a": "0",
+		"g": "1",
+		"m": "1",
+		"p": "2",
+		"z": "2",
+	} {
+		path, err := p.Partition(key, nil)
+		suite.NoError(err)
+		suite.Equal([]string{expected}, path, key)
+	}
+}
+
+func (suite *PartitionTestSuite) TestRangeNames() {
+	p := RangePartitioner{Bounds: []string{"n"}, Names: []string{"a-m", "n-z"}}
+	path, err := p.Partition("x", nil)
+	suite.NoError(err)
+	suite.Equal([]string{"n-z"}, path)
+	p.Names = p.Names[:1]
+	_, err = p.Partition("x", nil)
+	suite.Error(err)
+}
+
+func (suite *PartitionTestSuite) TestTime() {
+	p := TimePartitioner{}
+	path, err := p.Partition("2026-10-16T14:35:00+02:00", nil)
+	suite.NoError(err)
+	suite.Equal([]string{"20261016T120000Z"}, path)
+	p = TimePartitioner{Window: 24 * time.Hour, Layout: "2006-01-02 15:04", Format: "2006-01-02"}
+	path, err = p.Partition("2026-10-16 23:59", nil)
+	suite.NoError(err)
+	suite.Equal([]string{"2026-10-16"}, path)
+	_, err = p.Partition("yesterday", nil)
+	suite.Error(err)
+}
+
+func (suite *PartitionTestSuite) TestTimeNow() {
+	p := TimePartitioner{Window: 24 * time.Hour, Format: "2006-01-02"}
+	path, err := p.Partition("", nil)
+	suite.NoError(err)
+	suite.Equal([]string{time.Now().UTC().Format("2006-01-02")}, path)
+}
+
+func (suite *PartitionTestSuite) TestField() {
+	p := FieldPartitioner{Field: "customer"}
+	path, err := p.Partition("", [][]byte{[]byte(`{"customer":"acme","n":1}`)})
+	suite.NoError(err)
+	suite.Equal([]string{"acme"}, path)
+	p = FieldPartitioner{Field: "user.id"}
+	path, err = p.Partition("", [][]byte{[]byte(`{"user":{"id":42}}`)})
+	suite.NoError(err)
+	suite.Equal([]string{"42"}, path)
+}
+
+func (suite *PartitionTestSuite) TestFieldThen() {
+	p := FieldPartitioner{Field: "ts", Then: TimePartitioner{Format: "2006-01-02"}}
+	path, err := p.Partition("", [][]byte{[]byte(`{"ts":"2026-10-16T14:35:00Z"}`)})
+	suite.NoError(err)
+	suite.Equal([]string{"2026-10-16"}, path)
+}
+
+func (suite *PartitionTestSuite) TestFieldInvalid() {
+	p := FieldPartitioner{Field: "user.id"}
+	_, err := p.Partition("", nil)
+	suite.Error(err)
+	_, err = p.Partition("", [][]byte{[]byte(`not json`)})
+	suite.Error(err)
+	_, err = p.Partition("", [][]byte{[]byte(`{"user":{}}`)})
+	suite.Error(err)
+	_, err = p.Partition("", [][]byte{[]byte(`{"user":"bob"}`)})
+	suite.Error(err)
+}
+
+func (suite *PartitionTestSuite) TestWriteKeyed() {
+	buffer := NewBuffer(BufferOptions{
+		Root:        "./test",
+		Fs:          afero.NewMemMapFs(),
+		Partitioner: RangePartitioner{Bounds: []string{"n"}, Names: []string{"a-m", "n-z"}},
+	})
+	suite.NoError(buffer.WriteKeyed("acme", []byte("hello")))
+	suite.NoError(buffer.WriteKeyed("zeta", []byte("world")))
+	suite.NoError(buffer.WriteKeyed("bob", []byte("!")))
+	bucket, err := buffer.Get("a-m")
+	suite.NoError(err)
+	suite.EqualValues(2, bucket.Writes())
+	bucket, err = buffer.Get("n-z")
+	suite.NoError(err)
+	suite.EqualValues(1, bucket.Writes())
+}
+
+func (suite *PartitionTestSuite) TestWriteKeyedNested() {
+	buffer := NewBuffer(BufferOptions{
+		Root:        "./test",
+		Fs:          afero.NewMemMapFs(),
+		Partitioner: nested{},
+	})
+	suite.NoError(buffer.WriteKeyed("acme", []byte("hello")))
+	suite.EqualValues(5, buffer.TreeBytes("customers"))
+	suite.Equal([]string{"acme"}, buffer.Children("customers"))
+}
+
+func (suite *PartitionTestSuite) TestWriteKeyedNoPartitioner() {
+	buffer := NewBuffer(BufferOptions{
+		Root: "./test",
+		Fs:   afero.NewMemMapFs(),
+	})
+	suite.True(errors.Is(buffer.WriteKeyed("acme", []byte("hello")), ErrNoPartitioner))
+	suite.EqualValues(0, buffer.Size())
+}
+
+type nested struct{}
+
+func (nested) Partition(key string, data [][]byte) ([]string, error) {
+	return []string{"customers", key}, nil
+}
@@ -0,0 +1,188 @@
+package buffer
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrQuotaExceeded is returned when a write would take a buffer past one of
+// its configured limits.
+var ErrQuotaExceeded = errors.New("buffer quota exceeded")
+
+// QuotaPolicy determines what happens when a write would exceed a quota.
+type QuotaPolicy int
+
+const (
+	// QuotaReject fails the write immediately with ErrQuotaExceeded.
+	QuotaReject QuotaPolicy = iota
+	// QuotaBlock waits until enough space has been freed by destroying buckets
+	// or until the context given to WriteContext is done. A write that could
+	// never fit, even in an empty buffer, still fails with ErrQuotaExceeded.
+	QuotaBlock
+)
+
+// quota keeps track of how much of each limit is in use. Space is reserved
+// before writing, so concurrent writers cannot overshoot a limit together.
+type quota struct {
+	sync.Mutex
+	maxBytes       uint64
+	maxBucketBytes uint64
+	maxBuckets     uint
+	policy         QuotaPolicy
+	// usage reaching these sends a warning (zero means no warning)
+	warnBytes       uint64
+	warnBucketBytes uint64
+
+	total   uint64
+	buckets map[string]uint64
+	// closed and replaced whenever space is freed, to wake blocked writers
+	freed chan struct{}
+}
+
+func newQuota(o BufferOptions) *quota {
+	return &quota{
+		maxBytes:       o.MaxBytes,
+		maxBucketBytes: o.MaxBucketBytes,
+		maxBuckets:     o.MaxBuckets,
+		policy:         o.QuotaPolicy,
+		buckets:        make(map[string]uint64),
+		freed:          make(chan struct{}),
+
+		warnBytes:       uint64(o.QuotaWarning * float64(o.MaxBytes)),
+		warnBucketBytes: uint64(o.QuotaWarning * float64(o.MaxBucketBytes)),
+	}
+}
+
+// admit reserves a slot for a new bucket.
+func (q *quota) admit(ctx context.Context, name string) error {
+	if q.maxBuckets == 0 {
+		return q.add(name, 0)
+	}
+
+	return q.wait(ctx, func() (bool, bool) {
+		if _, ok := q.buckets[name]; ok {
+			return true, true
+		}
+		if uint(len(q.buckets)) >= q.maxBuckets {
+			return false, true
+		}
+		q.buckets[name] = 0
+		return true, true
+	})
+}
+
+// warning reports which warning thresholds were passed by a reservation.
+type warning struct {
+	total  bool
+	bucket bool
+	// the total usage right after the reservation
+	usage uint64
+}
+
+// reserve sets aside space for writing n bytes to the named bucket.
+func (q *quota) reserve(ctx context.Context, name string, n uint64) (warning, error) {
+	if q.maxBytes == 0 && q.maxBucketBytes == 0 {
+		return warning{}, q.add(name, n)
+	}
+
+	var warn warning
+	err := q.wait(ctx, func() (bool, bool) {
+		if q.maxBytes > 0 && q.total+n > q.maxBytes {
+			return false, n <= q.maxBytes
+		}
+		if q.maxBucketBytes > 0 && q.buckets[name]+n > q.maxBucketBytes {
+			return false, n <= q.maxBucketBytes
+		}
+		warn.total = passed(q.warnBytes, q.total, n)
+		warn.bucket = passed(q.warnBucketBytes, q.buckets[name], n)
+		q.total += n
+		q.buckets[name] += n
+		warn.usage = q.total
+		return true, true
+	})
+	return warn, err
+}
+
+// passed determines whether adding n to the usage reaches the threshold.
+func passed(threshold, usage, n uint64) bool {
+	return threshold > 0 && usage < threshold && usage+n >= threshold
+}
+
+// add records usage without checking any limits, this is used when there are
+// no limits to check or when restoring existing buckets.
+func (q *quota) add(name string, n uint64) error {
+	q.Lock()
+	defer q.Unlock()
+
+	q.total += n
+	q.buckets[name] += n
+	return nil
+}
+
+// wait calls try until it succeeds. Each attempt is made while holding the
+// lock and reports whether it succeeded and whether it could ever succeed.
+func (q *quota) wait(ctx context.Context, try func() (ok bool, possible bool)) error {
+	for {
+		q.Lock()
+		ok, possible := try()
+		freed := q.freed
+		q.Unlock()
+
+		if ok {
+			return nil
+		} else if !possible || q.policy != QuotaBlock {
+			return ErrQuotaExceeded
+		}
+
+		select {
+		case <-freed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// release gives back space that was reserved but not used.
+func (q *quota) release(name string, n uint64) {
+	q.Lock()
+	defer q.Unlock()
+
+	q.total -= n
+	q.buckets[name] -= n
+	q.wake()
+}
+
+// remove releases everything used by the named bucket.
+func (q *quota) remove(name string) {
+	q.Lock()
+	defer q.Unlock()
+
+	q.total -= q.buckets[name]
+	delete(q.buckets, name)
+	q.wake()
+}
+
+// reset releases everything.
+func (q *quota) reset() {
+	q.Lock()
+	defer q.Unlock()
+
+	q.total = 0
+	q.buckets = make(map[string]uint64)
+	q.wake()
+}
+
+func (q *quota) wake() {
+	close(q.freed)
+	q.freed = make(chan struct{})
+}
+
+// size adds up the length of all the chunks in a single write.
+func size(data [][]byte) uint64 {
+	var n uint64
+	for _, chunk := range data {
+		n += uint64(len(chunk))
+	}
+	return n
+}
@@ -0,0 +1,150 @@
+package buffer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/suite"
+)
+
+type QuotaTestSuite struct {
+	suite.Suite
+	options BufferOptions
+}
+
+func TestQuotaTestSuite(t *testing.T) {
+	suite.Run(t, new(QuotaTestSuite))
+}
+
+func (suite *QuotaTestSuite) SetupTest() {
+	suite.options = BufferOptions{
+		Root: "./test",
+		Fs:   afero.NewMemMapFs(),
+	}
+}
+
+func (suite *QuotaTestSuite) TestUnlimited() {
+	buffer := NewBuffer(suite.options)
+	suite.NoError(buffer.Write("1", make([]byte, 1024)))
+	suite.NoError(buffer.Write("2", make([]byte, 1024)))
+}
+
+func (suite *QuotaTestSuite) TestMaxBytes() {
+	suite.options.MaxBytes = 10
+	buffer := NewBuffer(suite.options)
+	suite.NoError(buffer.Write("1", []byte("hello")))
+	suite.NoError(buffer.Write("2", []byte("world")))
+	suite.True(errors.Is(buffer.Write("3", []byte("!")), ErrQuotaExceeded))
+	suite.EqualValues(10, buffer.Bytes())
+}
+
+func (suite *QuotaTestSuite) TestMaxBucketBytes() {
+	suite.options.MaxBucketBytes = 5
+	buffer := NewBuffer(suite.options)
+	suite.NoError(buffer.Write("1", []byte("hello")))
+	suite.True(errors.Is(buffer.Write("1", []byte("!")), ErrQuotaExceeded))
+	suite.NoError(buffer.Write("2", []byte("world")))
+}
+
+func (suite *QuotaTestSuite) TestMaxBuckets() {
+	suite.options.MaxBuckets = 2
+	buffer := NewBuffer(suite.options)
+	suite.NoError(buffer.Write("1", []byte("hello")))
+	suite.NoError(buffer.Write("2", []byte("world")))
+	suite.NoError(buffer.Write("1", []byte("again")))
+	suite.True(errors.Is(buffer.Write("3", []byte("!")), ErrQuotaExceeded))
+	_, err := buffer.Get("3")
+	suite.True(errors.Is(err, ErrQuotaExceeded))
+	suite.EqualValues(2, buffer.Size())
+}
+
+func (suite *QuotaTestSuite) TestDestroyBucket() {
+	suite.options.MaxBytes = 5
+	suite.options.MaxBuckets = 1
+	buffer := NewBuffer(suite.options)
+	suite.NoError(buffer.Write("1", []byte("hello")))
+	suite.NoError(buffer.DestroyBucket("1"))
+	suite.NoError(buffer.Write("2", []byte("world")))
+	suite.Equal([]string{"2"}, buffer.Buckets())
+}
+
+func (suite *QuotaTestSuite) TestReset() {
+	suite.options.MaxBytes = 5
+	buffer := NewBuffer(suite.options)
+	suite.NoError(buffer.Write("1", []byte("hello")))
+	suite.NoError(buffer.Reset())
+	suite.NoError(buffer.Write("1", []byte("world")))
+}
+
+func (suite *QuotaTestSuite) TestSealed() {
+	suite.options.MaxBytes = 100
+	buffer := NewBuffer(suite.options)
+	suite.NoError(buffer.Write("a", make([]byte, 10)))
+	suite.NoError(buffer.CloseBucket("a"))
+	for n := 0; n < 9; n++ {
+		suite.True(errors.Is(buffer.Write("a", make([]byte, 10)), ErrBucketSealed))
+	}
+
+	// the rejected writes gave their space back
+	suite.NoError(buffer.Write("b", make([]byte, 80)))
+	suite.NoError(buffer.Close())
+	for n := 0; n < 2; n++ {
+		suite.True(errors.Is(buffer.Write("b", make([]byte, 10)), ErrBucketSealed))
+	}
+	suite.NoError(buffer.ReopenBucket("b"))
+	suite.NoError(buffer.Write("b", make([]byte, 10)))
+	suite.EqualValues(100, buffer.Bytes())
+}
+
+func (suite *QuotaTestSuite) TestBlock() {
+	suite.options.MaxBytes = 5
+	suite.options.QuotaPolicy = QuotaBlock
+	buffer := NewBuffer(suite.options)
+	suite.NoError(buffer.Write("1", []byte("hello")))
+
+	done := make(chan error)
+	go func() {
+		done <- buffer.Write("2", []byte("world"))
+	}()
+
+	select {
+	case <-done:
+		suite.Fail("write should be blocked")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	suite.NoError(buffer.DestroyBucket("1"))
+	suite.NoError(<-done)
+	suite.EqualValues(5, buffer.Bytes())
+}
+
+func (suite *QuotaTestSuite) TestBlockDeadline() {
+	suite.options.MaxBuckets = 1
+	suite.options.QuotaPolicy = QuotaBlock
+	buffer := NewBuffer(suite.options)
+	suite.NoError(buffer.Write("1", []byte("hello")))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	suite.True(errors.Is(buffer.WriteContext(ctx, "2", []byte("world")), context.DeadlineExceeded))
+}
+
+func (suite *QuotaTestSuite) TestBlockImpossible() {
+	suite.options.MaxBytes = 5
+	suite.options.QuotaPolicy = QuotaBlock
+	buffer := NewBuffer(suite.options)
+	suite.True(errors.Is(buffer.Write("1", []byte("hello world")), ErrQuotaExceeded))
+}
+
+func (suite *QuotaTestSuite) TestRecover() {
+	buffer := NewBuffer(suite.options)
+	suite.NoError(buffer.Write("1", []byte("hello")))
+	suite.NoError(buffer.Close())
+	suite.options.Recover = true
+	suite.options.MaxBytes = 5
+	recovered := NewBuffer(suite.options)
+	suite.NoError(recovered.Open())
+	suite.True(errors.Is(recovered.Write("1", []byte("!")), ErrQuotaExceeded))
+}
@@ -0,0 +1,340 @@
+package buffer
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"sort"
+
+	"github.com/spf13/afero"
+)
+
+// NewReader opens an independent reader for the contents of this bucket, with
+// its own file handles and offset, so any number of them can be used at once
+// without affecting each other or Read. The bucket must be closed first, and
+// the reader only sees what was written up until then. Make sure to close the
+// reader when done with it.
+//
+// When the bucket is compressed or encrypted, seeking backwards means reading
+// again from the beginning, and seeking relative to the end means reading the
+// whole bucket once to find out how long it is.
+func (b *Bucket) NewReader() (io.ReadSeekCloser, error) {
+	b.RLock()
+	defer b.RUnlock()
+
+	reader, err := b.newReader()
+	return reader, b.fail("read", err)
+}
+
+// ReadAt implements io.ReaderAt, reading from the decoded contents of the
+// bucket like Read does, but without affecting its offset. Each call opens its
+// own file handles, so use NewReader for lots of small reads instead.
+func (b *Bucket) ReadAt(p []byte, off int64) (int, error) {
+	b.RLock()
+	reader, err := b.newReader()
+	b.RUnlock()
+	if err != nil {
+		return 0, b.fail("read", err)
+	}
+	defer reader.Close()
+
+	n, err := reader.ReadAt(p, off)
+	return n, b.fail("read", err)
+}
+
+// bucketReader is what NewReader returns.
+type bucketReader interface {
+	io.ReadSeekCloser
+	io.ReaderAt
+}
+
+// memoryReader reads a bucket that is still held in memory.
+type memoryReader struct {
+	*bytes.Reader
+}
+
+func (memoryReader) Close() error {
+	return nil
+}
+
+// newReader does the work for NewReader, the caller must hold the lock.
+func (b *Bucket) newReader() (bucketReader, error) {
+	if b.open {
+		return nil, ErrBucketNotSealed
+	}
+	if !b.started() {
+		return nil, ErrBucketNotOpen
+	}
+
+	if b.memory != nil {
+		return memoryReader{bytes.NewReader(b.memory.Bytes())}, nil
+	}
+
+	if !b.plain() {
+		last, err := b.snapshot()
+		if err != nil {
+			return nil, err
+		}
+		return &decodedReader{bucket: b, segments: b.segment + 1, last: last, size: -1}, nil
+	}
+
+	paths := []string{b.path}
+	if b.segmented() {
+		paths = make([]string, b.segment+1)
+		for n := range paths {
+			paths[n] = b.segmentPath(n)
+		}
+	}
+	return openFiles(b.fs, paths)
+}
+
+// snapshot describes the last file of a bucket at some point, so that it can
+// still be read as it was after the bucket is reopened and written to.
+type snapshot struct {
+	size int64
+	// the end of an encrypted file, since its trailer is replaced by the next
+	// section when the bucket is reopened
+	tail []byte
+}
+
+// snapshot captures the last file of the bucket as it is now, the caller must
+// hold the lock.
+func (b *Bucket) snapshot() (*snapshot, error) {
+	path := b.path
+	if b.segmented() {
+		path = b.segmentPath(b.segment)
+	}
+
+	file, err := b.fs.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &snapshot{size: info.Size()}
+	if b.keys != nil && s.size >= encryptTrailerSize {
+		s.tail = make([]byte, encryptTrailerSize)
+		if _, err := file.ReadAt(s.tail, s.size-encryptTrailerSize); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// reader limits the file to what it held when the snapshot was taken, a nil
+// snapshot reads all of it.
+func (s *snapshot) reader(file io.Reader) io.Reader {
+	if s == nil {
+		return file
+	}
+
+	body := io.LimitReader(file, s.size-int64(len(s.tail)))
+	return io.MultiReader(body, bytes.NewReader(s.tail))
+}
+
+// openFiles presents several plain files as one continuous stream, which
+// allows reading at any offset without decoding anything first.
+func openFiles(fs afero.Fs, paths []string) (*filesReader, error) {
+	files := &filesReader{offsets: make([]int64, 0, len(paths))}
+	for _, path := range paths {
+		file, err := fs.Open(path)
+		if err != nil {
+			files.Close()
+			return nil, err
+		}
+		info, err := file.Stat()
+		if err != nil {
+			file.Close()
+			files.Close()
+			return nil, err
+		}
+
+		files.files = append(files.files, file)
+		files.offsets = append(files.offsets, files.size)
+		files.size += info.Size()
+	}
+
+	files.SectionReader = io.NewSectionReader(files, 0, files.size)
+	return files, nil
+}
+
+type filesReader struct {
+	*io.SectionReader
+	files []afero.File
+	// where each file starts
+	offsets []int64
+	size    int64
+}
+
+// ReadAt is used by the embedded io.SectionReader, it finds the file holding
+// each offset in turn until p is full.
+func (f *filesReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("read before the start of the bucket")
+	}
+
+	var n int
+	for n < len(p) {
+		pos := off + int64(n)
+		if pos >= f.size {
+			return n, io.EOF
+		}
+
+		i := sort.Search(len(f.offsets), func(i int) bool {
+			return f.offsets[i] > pos
+		}) - 1
+		end := f.size
+		if i+1 < len(f.offsets) {
+			end = f.offsets[i+1]
+		}
+
+		chunk := p[n:]
+		if int64(len(chunk)) > end-pos {
+			chunk = chunk[:end-pos]
+		}
+		read, err := f.files[i].ReadAt(chunk, pos-f.offsets[i])
+		n += read
+		if read < len(chunk) {
+			// the file got shorter since it was opened
+			if err == nil || err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func (f *filesReader) Close() error {
+	var err error
+	for _, file := range f.files {
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// decodedReader reads a compressed or encrypted bucket, since there is no way
+// to know where an offset is in the file without decoding everything before
+// it, seeking is emulated by reading and throwing data away.
+type decodedReader struct {
+	bucket   *Bucket
+	segments int
+	last     *snapshot
+	source   io.ReadCloser
+	// how much has been read from source
+	read int64
+	// the offset that the next call to Read should start from
+	pos int64
+	// the full size, which is only known after seeking to the end
+	size int64
+}
+
+func (d *decodedReader) Read(p []byte) (int, error) {
+	if d.source == nil || d.read > d.pos {
+		if err := d.reset(); err != nil {
+			return 0, err
+		}
+	}
+	if d.read < d.pos {
+		skipped, err := io.CopyN(ioutil.Discard, d.source, d.pos-d.read)
+		d.read += skipped
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := d.source.Read(p)
+	d.read += int64(n)
+	d.pos += int64(n)
+	return n, err
+}
+
+// reset starts reading again from the beginning.
+func (d *decodedReader) reset() error {
+	if err := d.Close(); err != nil {
+		return err
+	}
+
+	source, err := d.bucket.sourceOf(d.segments, d.last)
+	if err != nil {
+		return err
+	}
+	d.source = source
+	d.read = 0
+	return nil
+}
+
+func (d *decodedReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += d.pos
+	case io.SeekEnd:
+		if d.size < 0 {
+			size, err := d.measure()
+			if err != nil {
+				return 0, err
+			}
+			d.size = size
+		}
+		offset += d.size
+	}
+
+	if offset < 0 {
+		return 0, errors.New("seek before the start of the bucket")
+	}
+	d.pos = offset
+	return offset, nil
+}
+
+// measure reads through a separate copy of the source to find the full size.
+func (d *decodedReader) measure() (int64, error) {
+	source, err := d.bucket.sourceOf(d.segments, d.last)
+	if err != nil {
+		return 0, err
+	}
+	defer source.Close()
+
+	return io.Copy(ioutil.Discard, source)
+}
+
+// ReadAt reads through a separate copy of the source, so that it is safe to
+// use concurrently with Read and other calls to ReadAt.
+func (d *decodedReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("read before the start of the bucket")
+	}
+
+	source, err := d.bucket.sourceOf(d.segments, d.last)
+	if err != nil {
+		return 0, err
+	}
+	defer source.Close()
+
+	if _, err := io.CopyN(ioutil.Discard, source, off); err != nil {
+		return 0, err
+	}
+
+	n, err := io.ReadFull(source, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (d *decodedReader) Close() error {
+	if d.source == nil {
+		return nil
+	}
+
+	err := d.source.Close()
+	d.source = nil
+	return err
+}
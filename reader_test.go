@@ -0,0 +1,200 @@
+package buffer
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"sync"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/suite"
+)
+
+type ReaderTestSuite struct {
+	suite.Suite
+	fs afero.Fs
+}
+
+func TestReaderTestSuite(t *testing.T) {
+	suite.Run(t, new(ReaderTestSuite))
+}
+
+func (suite *ReaderTestSuite) SetupTest() {
+	suite.fs = afero.NewMemMapFs()
+}
+
+func (suite *ReaderTestSuite) TestNewReader() {
+	for name, o := range suite.options() {
+		bucket := suite.bucket(o, "hello ", "world")
+		reader, err := bucket.NewReader()
+		suite.NoError(err, name)
+		actual, err := ioutil.ReadAll(reader)
+		suite.NoError(err, name)
+		suite.Equal("hello world", string(actual), name)
+		suite.NoError(reader.Close(), name)
+	}
+}
+
+func (suite *ReaderTestSuite) TestIndependent() {
+	for name, o := range suite.options() {
+		bucket := suite.bucket(o, "hello ", "world")
+		first, err := bucket.NewReader()
+		suite.NoError(err, name)
+		second, err := bucket.NewReader()
+		suite.NoError(err, name)
+		suite.assertRead(first, "hello", name)
+		suite.assertRead(second, "hello wo", name)
+		suite.assertRead(first, " world", name)
+		suite.assertRead(bucket, "hel", name)
+		suite.assertRead(second, "rld", name)
+		suite.assertRead(bucket, "lo", name)
+		suite.NoError(first.Close(), name)
+		suite.NoError(second.Close(), name)
+	}
+}
+
+func (suite *ReaderTestSuite) TestSeek() {
+	for name, o := range suite.options() {
+		bucket := suite.bucket(o, "hello ", "world")
+		reader, err := bucket.NewReader()
+		suite.NoError(err, name)
+		suite.assertRead(reader, "hello wor", name)
+
+		pos, err := reader.Seek(1, io.SeekStart)
+		suite.NoError(err, name)
+		suite.EqualValues(1, pos, name)
+		suite.assertRead(reader, "ello", name)
+
+		pos, err = reader.Seek(2, io.SeekCurrent)
+		suite.NoError(err, name)
+		suite.EqualValues(7, pos, name)
+		suite.assertRead(reader, "or", name)
+
+		pos, err = reader.Seek(-3, io.SeekEnd)
+		suite.NoError(err, name)
+		suite.EqualValues(8, pos, name)
+		suite.assertRead(reader, "rld", name)
+
+		_, err = reader.Seek(-1, io.SeekStart)
+		suite.Error(err, name)
+
+		_, err = reader.Seek(100, io.SeekStart)
+		suite.NoError(err, name)
+		_, err = reader.Read(make([]byte, 1))
+		suite.Equal(io.EOF, err, name)
+		suite.NoError(reader.Close(), name)
+	}
+}
+
+func (suite *ReaderTestSuite) TestReadAt() {
+	for name, o := range suite.options() {
+		bucket := suite.bucket(o, "hello ", "world")
+		p := make([]byte, 5)
+		n, err := bucket.ReadAt(p, 4)
+		suite.NoError(err, name)
+		suite.Equal("o wor", string(p[:n]), name)
+		n, err = bucket.ReadAt(p, 8)
+		suite.Equal(io.EOF, err, name)
+		suite.Equal("rld", string(p[:n]), name)
+		n, err = bucket.ReadAt(p, 20)
+		suite.Equal(io.EOF, err, name)
+		suite.Equal(0, n, name)
+
+		// the offset for Read is not affected
+		suite.assertRead(bucket, "hello", name)
+	}
+}
+
+func (suite *ReaderTestSuite) TestReadAtNegative() {
+	options := suite.options()
+	options["memory"] = BucketOptions{SpillBytes: 100}
+	for name, o := range options {
+		suite.SetupTest()
+		bucket := suite.bucket(o, "hello ", "world")
+		n, err := bucket.ReadAt(make([]byte, 5), -1)
+		suite.Error(err, name)
+		suite.Equal(0, n, name)
+	}
+}
+
+func (suite *ReaderTestSuite) TestConcurrent() {
+	for name, o := range suite.options() {
+		bucket := suite.bucket(o, "hello ", "world")
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				reader, err := bucket.NewReader()
+				suite.NoError(err, name)
+				defer reader.Close()
+				actual, err := ioutil.ReadAll(reader)
+				suite.NoError(err, name)
+				suite.Equal("hello world", string(actual), name)
+				p := make([]byte, 5)
+				_, err = bucket.ReadAt(p, 6)
+				suite.NoError(err, name)
+				suite.Equal("world", string(p), name)
+			}()
+		}
+		wg.Wait()
+	}
+}
+
+func (suite *ReaderTestSuite) TestStillOpen() {
+	bucket := NewBucket(BucketOptions{Path: "./test/a", Fs: suite.fs})
+	_, err := bucket.NewReader()
+	suite.True(errors.Is(err, ErrBucketNotOpen))
+	suite.NoError(bucket.Open())
+	_, err = bucket.NewReader()
+	suite.True(errors.Is(err, ErrBucketNotSealed))
+	_, err = bucket.ReadAt(make([]byte, 1), 0)
+	suite.True(errors.Is(err, ErrBucketNotSealed))
+}
+
+func (suite *ReaderTestSuite) TestReopened() {
+	keys := KeyRing{Current: "a", Keys: map[string][]byte{"a": make([]byte, 32)}}
+	options := suite.options()
+	options["compressed"] = BucketOptions{Compression: "gzip"}
+	options["encrypted"] = BucketOptions{Encryption: keys}
+	options["encrypted segmented"] = BucketOptions{Encryption: keys, MaxSegmentWrites: 2}
+
+	for name, o := range options {
+		bucket := suite.bucket(o, "hello")
+		reader, err := bucket.NewReader()
+		suite.NoError(err, name)
+		suite.NoError(bucket.Reopen(), name)
+		suite.NoError(bucket.Write([]byte(" world")), name)
+		suite.NoError(bucket.Close(), name)
+
+		actual, err := ioutil.ReadAll(reader)
+		suite.NoError(err, name)
+		suite.Equal("hello", string(actual), name)
+		suite.NoError(reader.Close(), name)
+	}
+}
+
+func (suite *ReaderTestSuite) options() map[string]BucketOptions {
+	return map[string]BucketOptions{
+		"plain":      {},
+		"segmented":  {MaxSegmentBytes: 4},
+		"compressed": {Compression: "gzip", MaxSegmentWrites: 1},
+	}
+}
+
+func (suite *ReaderTestSuite) bucket(o BucketOptions, data ...string) *Bucket {
+	bucket := openBucket(suite.T(), suite.fs, o)
+	for _, chunk := range data {
+		suite.NoError(bucket.Write([]byte(chunk)))
+	}
+	suite.NoError(bucket.Close())
+	return bucket
+}
+
+func (suite *ReaderTestSuite) assertRead(r io.Reader, expected string, name string) {
+	p := make([]byte, len(expected))
+	_, err := io.ReadFull(r, p)
+	suite.NoError(err, name)
+	suite.Equal(expected, string(p), name)
+}
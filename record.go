@@ -0,0 +1,155 @@
+package buffer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+)
+
+// recordHeaderSize is the number of bytes used to prefix each record with its
+// length when framing is enabled.
+const recordHeaderSize = 4
+
+// checksumSize is the number of additional header bytes used to store the
+// checksum of each record when checksums are enabled.
+const checksumSize = 4
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// the reasons given for a CorruptionError
+const (
+	reasonChecksum  = "checksum mismatch"
+	reasonTruncated = "truncated record"
+)
+
+// CorruptionError is returned when a record fails an integrity check.
+type CorruptionError struct {
+	// the byte offset of the start of the record
+	Offset int64
+	// the index of the record, starting at 0
+	Record int
+	// describes what was wrong with the record
+	Reason string
+}
+
+func (e *CorruptionError) Error() string {
+	return fmt.Sprintf("corrupt record %d at offset %d: %s", e.Record, e.Offset, e.Reason)
+}
+
+// writeRecord writes the given chunks as a single length-prefixed record,
+// optionally including a checksum. It returns the number of payload bytes that
+// were written.
+func writeRecord(w io.Writer, data [][]byte, checksum bool) (int, error) {
+	var size uint64
+	for _, chunk := range data {
+		size += uint64(len(chunk))
+	}
+	if size > math.MaxUint32 {
+		return 0, errors.New("record too large")
+	}
+
+	header := make([]byte, recordHeaderSize, recordHeaderSize+checksumSize)
+	binary.BigEndian.PutUint32(header, uint32(size))
+	if checksum {
+		// the length is included in the checksum so a damaged header is caught
+		sum := crc32.Update(0, crcTable, header)
+		for _, chunk := range data {
+			sum = crc32.Update(sum, crcTable, chunk)
+		}
+		header = header[:recordHeaderSize+checksumSize]
+		binary.BigEndian.PutUint32(header[recordHeaderSize:], sum)
+	}
+	if _, err := w.Write(header); err != nil {
+		return 0, err
+	}
+
+	var written int
+	for _, chunk := range data {
+		n, err := w.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+
+	return written, nil
+}
+
+// recordReader reads length-prefixed records from a stream, keeping track of
+// where it is so problems can be reported precisely.
+type recordReader struct {
+	r        io.Reader
+	checksum bool
+	offset   int64
+	index    int
+}
+
+// next reads a single record. It returns io.EOF when there are no more records.
+// When the stream ends in the middle of a record, io.ErrUnexpectedEOF is
+// returned, unless checksums are enabled, in which case it is reported as a
+// *CorruptionError like any other damage.
+func (r *recordReader) next() ([]byte, error) {
+	size := recordHeaderSize
+	if r.checksum {
+		size += checksumSize
+	}
+
+	header := make([]byte, size)
+	if n, err := io.ReadFull(r.r, header); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, r.truncated(int64(n))
+		}
+		return nil, err
+	}
+
+	// the payload is copied rather than allocated up front, that way a bogus
+	// length cannot cause a huge allocation for a stream that is not that long
+	length := int64(binary.BigEndian.Uint32(header))
+	var payload bytes.Buffer
+	if n, err := io.CopyN(&payload, r.r, length); err != nil {
+		if err == io.EOF {
+			return nil, r.truncated(int64(size) + n)
+		}
+		return nil, err
+	}
+
+	if r.checksum {
+		sum := crc32.Update(0, crcTable, header[:recordHeaderSize])
+		sum = crc32.Update(sum, crcTable, payload.Bytes())
+		if sum != binary.BigEndian.Uint32(header[recordHeaderSize:]) {
+			err := r.corrupt(reasonChecksum)
+			r.advance(int64(size) + length)
+			return nil, err
+		}
+	}
+
+	r.advance(int64(size) + length)
+	return payload.Bytes(), nil
+}
+
+func (r *recordReader) advance(n int64) {
+	r.offset += n
+	r.index++
+}
+
+func (r *recordReader) truncated(n int64) error {
+	if !r.checksum {
+		return io.ErrUnexpectedEOF
+	}
+
+	err := r.corrupt(reasonTruncated)
+	r.advance(n)
+	return err
+}
+
+func (r *recordReader) corrupt(reason string) *CorruptionError {
+	return &CorruptionError{
+		Offset: r.offset,
+		Record: r.index,
+		Reason: reason,
+	}
+}
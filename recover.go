@@ -0,0 +1,308 @@
+package buffer
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// Recover is an alternative to Open that picks up an existing file on disk
+// rather than starting from scratch. The Writes and Bytes counters are restored
+// by reading through the file, after which the bucket is open and will append
+// any further writes. (call Close to proceed straight to reading instead)
+// This is only for a fresh instance, a bucket that has been opened before (even
+// if it has since been closed) fails with ErrBucketOpen, use Reopen instead.
+//
+// A file that was cut off part way through, usually by a crash, is truncated
+// to the last complete record for framed buckets and to the last readable byte
+// otherwise. For encrypted buckets, this includes anything after a chunk that
+// fails authentication. Since record boundaries are not stored for buckets
+// that are not framed, Writes cannot be restored for them and only counts new
+// writes, which is reported by WritesKnown.
+func (b *Bucket) Recover() (err error) {
+	b.Lock()
+	defer b.Unlock()
+	defer b.wrap("recover", &err)
+
+	if b.open || b.started() {
+		return ErrBucketOpen
+	}
+	if err := b.checkCSV(); err != nil {
+		return err
+	}
+
+	b.writes = 0
+	b.bytes = 0
+	b.disk = 0
+
+	path := b.path
+	if b.segmented() {
+		count, err := b.countSegments()
+		if err != nil {
+			return err
+		}
+
+		// the earlier segments were finished when rotating, so they only need
+		// to be counted
+		for n := 0; n < count-1; n++ {
+			result, err := b.scan(b.segmentPath(n))
+			if err != nil {
+				return err
+			}
+			info, err := b.fs.Stat(b.segmentPath(n))
+			if err != nil {
+				return err
+			}
+			b.writes += result.writes
+			b.bytes += result.bytes
+			b.disk += uint64(info.Size())
+		}
+
+		b.segment = count - 1
+		path = b.segmentPath(b.segment)
+	}
+
+	result, err := b.scan(path)
+	if err != nil {
+		return err
+	}
+	b.writes += result.writes
+	b.bytes += result.bytes
+	b.segmentWrites = result.writes
+	b.segmentBytes = result.bytes
+	b.uncounted = !b.framed && b.bytes > 0
+
+	if result.complete || b.plain() {
+		err = b.resume(path, result.intact)
+	} else {
+		err = b.rewrite(path, result.intact)
+	}
+	if err != nil {
+		return err
+	}
+
+	b.open = true
+	b.background()
+
+	return b.acquire()
+}
+
+// plain indicates whether the file contents are stored without any encoding,
+// meaning offsets in the file match the data that was written.
+func (b *Bucket) plain() bool {
+	return b.compression == "" && b.keys == nil
+}
+
+// countSegments determines how many segments exist on disk for this bucket.
+func (b *Bucket) countSegments() (int, error) {
+	var count int
+	for {
+		exists, err := afero.Exists(b.fs, b.segmentPath(count))
+		if err != nil {
+			return 0, err
+		} else if !exists {
+			break
+		}
+		count++
+	}
+
+	if count == 0 {
+		return 0, &os.PathError{Op: "recover", Path: b.path, Err: os.ErrNotExist}
+	}
+	return count, nil
+}
+
+// scanResult describes the existing contents of a file.
+type scanResult struct {
+	writes uint
+	bytes  uint64
+	// the number of decoded bytes that are intact
+	intact int64
+	// whether the file ended cleanly
+	complete bool
+}
+
+// scan reads through an existing file to count what was written to it.
+func (b *Bucket) scan(path string) (*scanResult, error) {
+	file, err := b.fs.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader, err := b.decode(file)
+	if err != nil {
+		return nil, err
+	}
+
+	if !b.framed {
+		n, err := io.Copy(ioutil.Discard, reader)
+		result := &scanResult{bytes: uint64(n), intact: n}
+		if truncated(err) {
+			return result, nil
+		} else if err != nil {
+			return nil, err
+		}
+		result.complete = true
+		return result, nil
+	}
+
+	result := new(scanResult)
+	records := &recordReader{r: bufio.NewReader(reader), checksum: b.checksum}
+	for {
+		result.intact = records.offset
+		record, err := records.next()
+		if err == io.EOF {
+			result.complete = true
+			return result, nil
+		} else if truncated(err) {
+			return result, nil
+		} else if corrupt, ok := err.(*CorruptionError); ok && corrupt.Reason == reasonChecksum {
+			// damaged records are left for Verify to report, they are still
+			// counted as a write since the record itself is whole
+			result.writes++
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		result.writes++
+		result.bytes += uint64(len(record))
+	}
+}
+
+// truncated determines whether an error from reading the file indicates that
+// it was cut off.
+func truncated(err error) bool {
+	if corrupt, ok := err.(*CorruptionError); ok {
+		return corrupt.Reason == reasonTruncated
+	}
+	return err == io.ErrUnexpectedEOF || err == ErrTampered
+}
+
+// resume opens the existing file for appending. If the file is not encoded,
+// anything past the intact portion is removed first. When it is encoded, new
+// writes are added as a separate stream after the existing contents.
+func (b *Bucket) resume(path string, intact int64) error {
+	file, err := b.fs.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+
+	if b.plain() {
+		if err := file.Truncate(intact); err != nil {
+			file.Close()
+			return err
+		}
+	}
+
+	size, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	b.file = file
+	b.disk += uint64(size)
+
+	if b.keys != nil {
+		if err := b.unseal(); err != nil {
+			return err
+		}
+	}
+	return b.encode(file)
+}
+
+// rewrite replaces an encoded file with a new one that contains only the
+// intact portion of the original. The new file remains open for appending.
+func (b *Bucket) rewrite(path string, intact int64) error {
+	dir, base := filepath.Split(path)
+	temp := filepath.Join(dir, "."+base+".recover")
+
+	file, err := b.fs.Create(temp)
+	if err != nil {
+		return err
+	}
+
+	b.file = file
+	b.sections = 0
+	if err := b.encode(file); err != nil {
+		return err
+	}
+
+	original, err := b.fs.Open(path)
+	if err != nil {
+		return err
+	}
+	defer original.Close()
+
+	reader, err := b.decode(original)
+	if err != nil {
+		return err
+	}
+	if _, err := io.CopyN(b.writer, reader, intact); err != nil {
+		return err
+	}
+
+	return b.fs.Rename(temp, path)
+}
+
+// restore rehydrates buckets for all the files already in the root directory,
+// or the directories when buckets are segmented. Any other directories contain
+// nested buckets. Hidden files are skipped since they are used for internal
+// bookkeeping.
+func (b *Buffer) restore(dir string, prefix []string) error {
+	files, err := afero.ReadDir(b.fs, filepath.Join(b.root, dir))
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if strings.HasPrefix(file.Name(), ".") {
+			continue
+		}
+
+		name, err := b.names.Name(file.Name())
+		if err != nil {
+			return err
+		}
+		key := filepath.Join(dir, file.Name())
+		path := append(prefix[:len(prefix):len(prefix)], name)
+
+		if file.IsDir() {
+			bucket, err := b.isSegmentedBucket(key)
+			if err != nil {
+				return err
+			} else if !bucket {
+				if err := b.restore(key, path); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+
+		bucket := b.newBucket(key, path)
+		if err := bucket.Recover(); err != nil {
+			return err
+		}
+		b.buckets[key] = bucket
+		b.quota.add(key, bucket.Bytes())
+		b.events.emit(bucket.event(EventCreated))
+	}
+
+	return nil
+}
+
+// isSegmentedBucket determines whether a directory holds the segments of a
+// bucket rather than nested buckets.
+func (b *Buffer) isSegmentedBucket(key string) (bool, error) {
+	if !b.segmented() {
+		return false, nil
+	}
+	return afero.Exists(b.fs, filepath.Join(b.root, key, segmentName(0)))
+}
@@ -0,0 +1,175 @@
+package buffer
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/suite"
+)
+
+type RecoverTestSuite struct {
+	suite.Suite
+	fs afero.Fs
+}
+
+func TestRecoverTestSuite(t *testing.T) {
+	suite.Run(t, new(RecoverTestSuite))
+}
+
+func (suite *RecoverTestSuite) SetupTest() {
+	suite.fs = afero.NewMemMapFs()
+}
+
+func (suite *RecoverTestSuite) TestPlain() {
+	o := BucketOptions{}
+	suite.write(o, "hello ")
+	bucket := suite.recover(o)
+	suite.EqualValues(6, bucket.Bytes())
+	suite.EqualValues(6, bucket.DiskBytes())
+	suite.EqualValues(0, bucket.Writes())
+	suite.False(bucket.WritesKnown())
+	suite.NoError(bucket.Write([]byte("world")))
+	suite.EqualValues(1, bucket.Writes())
+	suite.assertContents(bucket, "hello world")
+}
+
+func (suite *RecoverTestSuite) TestPlainEmpty() {
+	o := BucketOptions{}
+	suite.write(o)
+	bucket := suite.recover(o)
+	suite.True(bucket.WritesKnown())
+}
+
+func (suite *RecoverTestSuite) TestFramed() {
+	o := BucketOptions{Framed: true}
+	suite.write(o, "hello", "world")
+	bucket := suite.recover(o)
+	suite.EqualValues(2, bucket.Writes())
+	suite.True(bucket.WritesKnown())
+	suite.EqualValues(10, bucket.Bytes())
+	suite.NoError(bucket.Write([]byte("again")))
+	suite.assertRecords(bucket, "hello", "world", "again")
+}
+
+func (suite *RecoverTestSuite) TestFramedTruncated() {
+	o := BucketOptions{Checksum: true}
+	suite.write(o, "hello", "world")
+	suite.truncate(3)
+	bucket := suite.recover(o)
+	suite.EqualValues(1, bucket.Writes())
+	suite.EqualValues(5, bucket.Bytes())
+	suite.EqualValues(13, bucket.DiskBytes())
+	suite.NoError(bucket.Write([]byte("again")))
+	suite.assertRecords(bucket, "hello", "again")
+}
+
+func (suite *RecoverTestSuite) TestCompressed() {
+	o := BucketOptions{Framed: true, Compression: "zlib"}
+	suite.write(o, "hello", "world")
+	bucket := suite.recover(o)
+	suite.EqualValues(2, bucket.Writes())
+	suite.NoError(bucket.Write([]byte("again")))
+	suite.assertRecords(bucket, "hello", "world", "again")
+}
+
+func (suite *RecoverTestSuite) TestCompressedTruncated() {
+	o := BucketOptions{Framed: true, Compression: "gzip"}
+	suite.write(o, "hello", "world")
+	suite.truncate(4)
+	bucket := suite.recover(o)
+	suite.EqualValues(2, bucket.Writes())
+	suite.NoError(bucket.Write([]byte("again")))
+	suite.assertRecords(bucket, "hello", "world", "again")
+	suite.assertHiddenFileRemoved()
+}
+
+func (suite *RecoverTestSuite) TestEncryptedTruncated() {
+	keys := KeyRing{Current: "a", Keys: map[string][]byte{"a": bytes.Repeat([]byte("a"), 32)}}
+	o := BucketOptions{Encryption: keys}
+	suite.write(o, "hello world")
+	// past the trailer and into the only chunk
+	suite.truncate(encryptTrailerSize + 1)
+	bucket := suite.recover(o)
+	suite.EqualValues(0, bucket.Bytes())
+	suite.NoError(bucket.Write([]byte("again")))
+	suite.assertContents(bucket, "again")
+}
+
+func (suite *RecoverTestSuite) TestMissing() {
+	bucket := NewBucket(BucketOptions{Path: "./test/a", Fs: suite.fs})
+	suite.Error(bucket.Recover())
+}
+
+func (suite *RecoverTestSuite) TestAlreadyOpen() {
+	bucket := NewBucket(BucketOptions{Path: "./test/a", Fs: suite.fs})
+	suite.NoError(bucket.Open())
+	suite.True(errors.Is(bucket.Recover(), ErrBucketOpen))
+}
+
+func (suite *RecoverTestSuite) TestAlreadyClosed() {
+	bucket := openBucket(suite.T(), suite.fs, BucketOptions{})
+	suite.NoError(bucket.Write([]byte("hello")))
+	suite.NoError(bucket.Close())
+	file := bucket.file
+	suite.True(errors.Is(bucket.Recover(), ErrBucketOpen))
+	suite.Equal(file, bucket.file)
+	suite.assertContents(bucket, "hello")
+}
+
+// write simulates a previous run, leaving the bucket closed so everything is
+// written out to the file.
+func (suite *RecoverTestSuite) write(o BucketOptions, data ...string) {
+	bucket := openBucket(suite.T(), suite.fs, o)
+	for _, chunk := range data {
+		suite.NoError(bucket.Write([]byte(chunk)))
+	}
+	suite.NoError(bucket.Close())
+}
+
+// truncate cuts the given number of bytes off the end of the file, simulating
+// a crash part way through a write.
+func (suite *RecoverTestSuite) truncate(n int64) {
+	info, err := suite.fs.Stat("./test/a")
+	suite.NoError(err)
+	file, err := suite.fs.OpenFile("./test/a", os.O_RDWR, 0)
+	suite.NoError(err)
+	suite.NoError(file.Truncate(info.Size() - n))
+	suite.NoError(file.Close())
+}
+
+func (suite *RecoverTestSuite) recover(o BucketOptions) *Bucket {
+	o.Path = "./test/a"
+	o.Fs = suite.fs
+	bucket := NewBucket(o)
+	suite.NoError(bucket.Recover())
+	return bucket
+}
+
+func (suite *RecoverTestSuite) assertContents(bucket *Bucket, expected string) {
+	suite.NoError(bucket.Close())
+	actual, err := ioutil.ReadAll(bucket)
+	suite.NoError(err)
+	suite.Equal(expected, string(actual))
+}
+
+func (suite *RecoverTestSuite) assertRecords(bucket *Bucket, expected ...string) {
+	suite.NoError(bucket.Close())
+	for _, record := range expected {
+		actual, err := bucket.NextRecord()
+		suite.NoError(err)
+		suite.Equal(record, string(actual))
+	}
+	_, err := bucket.NextRecord()
+	suite.Equal(io.EOF, err)
+}
+
+func (suite *RecoverTestSuite) assertHiddenFileRemoved() {
+	exists, err := afero.Exists(suite.fs, "test/.a.recover")
+	suite.NoError(err)
+	suite.False(exists)
+}
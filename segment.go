@@ -0,0 +1,193 @@
+package buffer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/spf13/afero"
+)
+
+// segmented indicates whether this bucket is split into multiple files.
+func (b *Bucket) segmented() bool {
+	return b.maxSegmentBytes > 0 || b.maxSegmentWrites > 0
+}
+
+// full indicates whether the current segment has reached one of its limits and
+// a new one should be started before writing anything else.
+func (b *Bucket) full() bool {
+	if !b.segmented() || b.segmentWrites == 0 {
+		return false
+	}
+	if b.maxSegmentWrites > 0 && b.segmentWrites >= b.maxSegmentWrites {
+		return true
+	}
+	return b.maxSegmentBytes > 0 && b.segmentBytes >= b.maxSegmentBytes
+}
+
+// segmentName is the file name used for a segment, the zero-padding keeps them
+// in order when listing the directory.
+func segmentName(n int) string {
+	return fmt.Sprintf("%08d.seg", n)
+}
+
+func (b *Bucket) segmentPath(n int) string {
+	return filepath.Join(b.path, segmentName(n))
+}
+
+// Segments retrieves the list of files that make up this bucket, in order. A
+// bucket that is not segmented is made up of a single file at its path.
+func (b *Bucket) Segments() []string {
+	b.RLock()
+	defer b.RUnlock()
+
+	if !b.segmented() {
+		return []string{b.path}
+	}
+	if b.memory != nil || !b.started() {
+		return nil
+	}
+
+	list := make([]string, 0, b.segment+1)
+	for n := 0; n <= b.segment; n++ {
+		list = append(list, b.segmentPath(n))
+	}
+	return list
+}
+
+// rotate finishes the current segment and starts writing to a new one.
+func (b *Bucket) rotate() error {
+	if err := b.end(); err != nil {
+		return err
+	}
+	if err := b.finish(); err != nil {
+		return err
+	}
+	if err := b.file.Close(); err != nil {
+		return err
+	}
+
+	file, err := b.fs.Create(b.segmentPath(b.segment + 1))
+	if err != nil {
+		return err
+	}
+
+	b.file = file
+	b.sections = 0
+	b.segment++
+	b.segmentWrites = 0
+	b.segmentBytes = 0
+
+	return b.encode(file)
+}
+
+// source opens a new handle for reading the decoded contents of the bucket
+// from the beginning.
+func (b *Bucket) source() (io.ReadCloser, error) {
+	return b.sourceOf(b.segment+1, nil)
+}
+
+// sourceOf is the same as source, but only reads the given number of segments
+// so the caller can hold on to it after releasing the lock. When a snapshot of
+// the last file is given, nothing written to it afterwards is read.
+func (b *Bucket) sourceOf(segments int, last *snapshot) (io.ReadCloser, error) {
+	if b.memory != nil {
+		return ioutil.NopCloser(bytes.NewReader(b.memory.Bytes())), nil
+	}
+	if b.segmented() {
+		return &multiSegmentReader{bucket: b, count: segments, last: last}, nil
+	}
+
+	file, err := b.fs.Open(b.path)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := b.decode(last.reader(file))
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &fileReader{Reader: reader, file: file}, nil
+}
+
+// fileReader reads decoded data, closing the underlying file when done.
+type fileReader struct {
+	io.Reader
+	file afero.File
+}
+
+func (f *fileReader) Close() error {
+	return f.file.Close()
+}
+
+// segmentReader presents all of the segments as one continuous stream.
+func (b *Bucket) segmentReader() *multiSegmentReader {
+	return &multiSegmentReader{
+		bucket: b,
+		count:  b.segment + 1,
+	}
+}
+
+// multiSegmentReader decodes each segment in turn, since each one is encoded
+// independently of the others.
+type multiSegmentReader struct {
+	bucket  *Bucket
+	count   int
+	next    int
+	current *fileReader
+	// limits the last segment, if set
+	last *snapshot
+}
+
+func (m *multiSegmentReader) Read(p []byte) (int, error) {
+	for {
+		if m.current == nil {
+			if m.next >= m.count {
+				return 0, io.EOF
+			}
+
+			file, err := m.bucket.fs.Open(m.bucket.segmentPath(m.next))
+			if err != nil {
+				return 0, err
+			}
+			var source io.Reader = file
+			if m.next == m.count-1 {
+				source = m.last.reader(file)
+			}
+			reader, err := m.bucket.decode(source)
+			if err != nil {
+				file.Close()
+				return 0, err
+			}
+
+			m.current = &fileReader{Reader: reader, file: file}
+			m.next++
+		}
+
+		n, err := m.current.Read(p)
+		if err == io.EOF {
+			if err := m.Close(); err != nil {
+				return n, err
+			}
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (m *multiSegmentReader) Close() error {
+	if m.current == nil {
+		return nil
+	}
+
+	err := m.current.Close()
+	m.current = nil
+	return err
+}
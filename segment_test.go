@@ -0,0 +1,150 @@
+package buffer
+
+import (
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/suite"
+)
+
+type SegmentTestSuite struct {
+	suite.Suite
+	fs afero.Fs
+}
+
+func TestSegmentTestSuite(t *testing.T) {
+	suite.Run(t, new(SegmentTestSuite))
+}
+
+func (suite *SegmentTestSuite) SetupTest() {
+	suite.fs = afero.NewMemMapFs()
+}
+
+func (suite *SegmentTestSuite) TestMaxWrites() {
+	bucket := openBucket(suite.T(), suite.fs, BucketOptions{MaxSegmentWrites: 2})
+	suite.write(bucket, "a", "b", "c", "d", "e")
+	suite.Equal([]string{
+		"test/a/00000000.seg",
+		"test/a/00000001.seg",
+		"test/a/00000002.seg",
+	}, bucket.Segments())
+	suite.assertSegment("test/a/00000000.seg", "ab")
+	suite.assertSegment("test/a/00000001.seg", "cd")
+	suite.assertSegment("test/a/00000002.seg", "e")
+	suite.EqualValues(5, bucket.Writes())
+	suite.EqualValues(5, bucket.Bytes())
+}
+
+func (suite *SegmentTestSuite) TestMaxBytes() {
+	bucket := openBucket(suite.T(), suite.fs, BucketOptions{MaxSegmentBytes: 4})
+	suite.write(bucket, "hello", "wo", "rld", "!")
+	suite.Len(bucket.Segments(), 3)
+	suite.assertSegment("test/a/00000000.seg", "hello")
+	suite.assertSegment("test/a/00000001.seg", "world")
+	suite.assertSegment("test/a/00000002.seg", "!")
+}
+
+func (suite *SegmentTestSuite) TestRead() {
+	bucket := openBucket(suite.T(), suite.fs, BucketOptions{MaxSegmentWrites: 1, Compression: "gzip"})
+	suite.write(bucket, "hello ", "world")
+	suite.NoError(bucket.Close())
+	actual, err := ioutil.ReadAll(bucket)
+	suite.NoError(err)
+	suite.Equal("hello world", string(actual))
+}
+
+func (suite *SegmentTestSuite) TestNextRecord() {
+	bucket := openBucket(suite.T(), suite.fs, BucketOptions{MaxSegmentWrites: 2, Checksum: true})
+	suite.write(bucket, "a", "b", "c")
+	suite.NoError(bucket.Close())
+	for _, expected := range []string{"a", "b", "c"} {
+		record, err := bucket.NextRecord()
+		suite.NoError(err)
+		suite.Equal(expected, string(record))
+	}
+	_, err := bucket.NextRecord()
+	suite.Equal(io.EOF, err)
+	problems, err := bucket.Verify()
+	suite.NoError(err)
+	suite.Empty(problems)
+}
+
+func (suite *SegmentTestSuite) TestUnsegmented() {
+	bucket := openBucket(suite.T(), suite.fs, BucketOptions{})
+	suite.Equal([]string{"./test/a"}, bucket.Segments())
+}
+
+func (suite *SegmentTestSuite) TestDestroy() {
+	bucket := openBucket(suite.T(), suite.fs, BucketOptions{MaxSegmentWrites: 1})
+	suite.write(bucket, "a", "b")
+	suite.NoError(bucket.Destroy())
+	exists, err := afero.Exists(suite.fs, "./test/a")
+	suite.NoError(err)
+	suite.False(exists)
+}
+
+func (suite *SegmentTestSuite) TestRecover() {
+	o := BucketOptions{MaxSegmentWrites: 2, Framed: true}
+	bucket := openBucket(suite.T(), suite.fs, o)
+	suite.write(bucket, "a", "b", "c")
+	suite.NoError(bucket.Close())
+	o.Path = "./test/a"
+	o.Fs = suite.fs
+	recovered := NewBucket(o)
+	suite.NoError(recovered.Recover())
+	suite.EqualValues(3, recovered.Writes())
+	suite.EqualValues(bucket.DiskBytes(), recovered.DiskBytes())
+	suite.write(recovered, "d", "e")
+	suite.Len(recovered.Segments(), 3)
+	suite.NoError(recovered.Close())
+	for _, expected := range []string{"a", "b", "c", "d", "e"} {
+		record, err := recovered.NextRecord()
+		suite.NoError(err)
+		suite.Equal(expected, string(record))
+	}
+}
+
+func (suite *SegmentTestSuite) TestRecoverMissing() {
+	bucket := NewBucket(BucketOptions{Path: "./test/a", Fs: suite.fs, MaxSegmentWrites: 1})
+	suite.Error(bucket.Recover())
+}
+
+func (suite *SegmentTestSuite) TestReopen() {
+	bucket := openBucket(suite.T(), suite.fs, BucketOptions{MaxSegmentWrites: 2, Compression: "zlib"})
+	suite.write(bucket, "a", "b", "c")
+	suite.NoError(bucket.Close())
+	suite.NoError(bucket.Reopen())
+	suite.write(bucket, "d", "e")
+	suite.NoError(bucket.Close())
+	suite.Len(bucket.Segments(), 3)
+	actual, err := ioutil.ReadAll(bucket)
+	suite.NoError(err)
+	suite.Equal("abcde", string(actual))
+}
+
+func (suite *SegmentTestSuite) TestBuffer() {
+	o := BufferOptions{Root: "./test", Fs: suite.fs, MaxSegmentWrites: 1}
+	buffer := NewBuffer(o)
+	suite.NoError(buffer.Write("1", []byte("a")))
+	suite.NoError(buffer.Write("1", []byte("b")))
+	suite.NoError(buffer.Close())
+	o.Recover = true
+	recovered := NewBuffer(o)
+	suite.NoError(recovered.Open())
+	suite.Equal([]string{"1"}, recovered.Buckets())
+	suite.EqualValues(2, recovered.Bytes())
+}
+
+func (suite *SegmentTestSuite) write(bucket *Bucket, data ...string) {
+	for _, chunk := range data {
+		suite.NoError(bucket.Write([]byte(chunk)))
+	}
+}
+
+func (suite *SegmentTestSuite) assertSegment(path string, expected string) {
+	actual, err := afero.ReadFile(suite.fs, path)
+	suite.NoError(err)
+	suite.Equal(expected, string(actual))
+}
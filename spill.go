@@ -0,0 +1,183 @@
+package buffer
+
+import (
+	"bytes"
+	"os"
+	"sort"
+	"sync"
+)
+
+// ceiling keeps the data held in memory by the buckets in a buffer within a
+// limit, by spilling the largest ones to disk. Buckets that are busy are passed
+// over, like with handles.
+type ceiling struct {
+	sync.Mutex
+	max     uint64
+	total   uint64
+	buckets map[*Bucket]uint64
+}
+
+func newCeiling(max uint64) *ceiling {
+	if max == 0 {
+		return nil
+	}
+
+	return &ceiling{
+		max:     max,
+		buckets: make(map[*Bucket]uint64),
+	}
+}
+
+// update records how much the bucket is holding in memory, spilling buckets
+// until the total is back under the limit. The caller must hold the lock for
+// the bucket, and any error spilling that bucket is returned.
+func (c *ceiling) update(b *Bucket, n uint64) error {
+	if c == nil {
+		return nil
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	c.set(b, n)
+	if c.total <= c.max {
+		return nil
+	}
+
+	largest := make([]*Bucket, 0, len(c.buckets))
+	for bucket := range c.buckets {
+		largest = append(largest, bucket)
+	}
+	sort.Slice(largest, func(i, j int) bool {
+		return c.buckets[largest[i]] > c.buckets[largest[j]]
+	})
+
+	var err error
+	for _, victim := range largest {
+		if c.total <= c.max {
+			break
+		}
+
+		if victim == b {
+			if err = b.spill(); err == nil {
+				c.set(b, 0)
+			}
+			continue
+		}
+		if !victim.TryLock() {
+			continue
+		}
+		if err := victim.spill(); err != nil {
+			if victim.syncErr == nil {
+				victim.syncErr = err
+			}
+		} else {
+			c.set(victim, 0)
+		}
+		victim.Unlock()
+	}
+	return err
+}
+
+// remove forgets about a bucket that is no longer holding anything in memory.
+func (c *ceiling) remove(b *Bucket) {
+	if c == nil {
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	c.set(b, 0)
+}
+
+func (c *ceiling) set(b *Bucket, n uint64) {
+	c.total -= c.buckets[b]
+	if n == 0 {
+		delete(c.buckets, b)
+	} else {
+		c.buckets[b] = n
+		c.total += n
+	}
+}
+
+// hold sets up the bucket to keep what is written in memory rather than
+// creating the file. Anything left at the path by a previous bucket is removed
+// so it cannot be mistaken for this one.
+func (b *Bucket) hold() error {
+	if err := b.fs.RemoveAll(b.offsetsPath()); err != nil {
+		return err
+	}
+	if b.segmented() {
+		if err := b.fs.RemoveAll(b.path); err != nil {
+			return err
+		}
+	} else if err := b.fs.Remove(b.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	b.memory = new(bytes.Buffer)
+	b.writer = b.memory
+	b.segment = 0
+	b.segmentWrites = 0
+	b.segmentBytes = 0
+
+	return nil
+}
+
+// held applies SpillBytes and MaxMemoryBytes after each write.
+func (b *Bucket) held() error {
+	if b.memory == nil {
+		return nil
+	}
+
+	if uint64(b.memory.Len()) > b.spillBytes {
+		if err := b.spill(); err != nil {
+			return err
+		}
+		b.ceiling.remove(b)
+		return nil
+	}
+
+	return b.ceiling.update(b, uint64(b.memory.Len()))
+}
+
+// spill moves everything held in memory into the file, after which the bucket
+// carries on like any other. When the bucket is sealed, reading carries on
+// from the same position.
+func (b *Bucket) spill() error {
+	if b.memory == nil {
+		return nil
+	}
+
+	// the first segment already has everything that was written so far
+	memory, writes, size := b.memory, b.segmentWrites, b.segmentBytes
+	if err := b.create(); err != nil {
+		b.writer = memory
+		return err
+	}
+	b.segmentWrites = writes
+	b.segmentBytes = size
+	if _, err := b.writer.Write(memory.Bytes()); err != nil {
+		return err
+	}
+	b.memory = nil
+
+	if b.open {
+		// flushing only starts once there is a WriteBuffer to flush
+		b.halt()
+		b.background()
+	} else {
+		if err := b.end(); err != nil {
+			return err
+		}
+		if err := b.finish(); err != nil {
+			return err
+		}
+		if err := b.reposition(); err != nil {
+			return err
+		}
+	}
+
+	return b.acquire()
+}
@@ -0,0 +1,211 @@
+package buffer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/suite"
+)
+
+type SpillTestSuite struct {
+	suite.Suite
+	fs afero.Fs
+}
+
+func TestSpillTestSuite(t *testing.T) {
+	suite.Run(t, new(SpillTestSuite))
+}
+
+func (suite *SpillTestSuite) SetupTest() {
+	suite.fs = afero.NewMemMapFs()
+}
+
+func (suite *SpillTestSuite) exists(path string) bool {
+	exists, err := afero.Exists(suite.fs, path)
+	suite.NoError(err)
+	return exists
+}
+
+func (suite *SpillTestSuite) TestMemory() {
+	bucket := NewBucket(BucketOptions{Path: "./test/a", Fs: suite.fs, SpillBytes: 10, Sync: SyncEveryWrite})
+	suite.NoError(bucket.Open())
+	suite.NoError(bucket.Write([]byte("hello")))
+	suite.NoError(bucket.Sync())
+	suite.False(suite.exists("./test/a"))
+	suite.Equal(uint64(0), bucket.DiskBytes())
+
+	suite.NoError(bucket.Close())
+	suite.False(suite.exists("./test/a"))
+	data, err := ioutil.ReadAll(bucket)
+	suite.NoError(err)
+	suite.Equal("hello", string(data))
+
+	suite.NoError(bucket.Destroy())
+}
+
+func (suite *SpillTestSuite) TestSpill() {
+	bucket := NewBucket(BucketOptions{Path: "./test/a", Fs: suite.fs, SpillBytes: 10})
+	suite.NoError(bucket.Open())
+	suite.NoError(bucket.Write([]byte("hello ")))
+	suite.NoError(bucket.Write([]byte("world")))
+	suite.True(suite.exists("./test/a"))
+	suite.NoError(bucket.Write([]byte("!")))
+	suite.NoError(bucket.Close())
+
+	data, err := ioutil.ReadAll(bucket)
+	suite.NoError(err)
+	suite.Equal("hello world!", string(data))
+	contents, err := afero.ReadFile(suite.fs, "./test/a")
+	suite.NoError(err)
+	suite.Equal("hello world!", string(contents))
+}
+
+func (suite *SpillTestSuite) TestStale() {
+	suite.NoError(afero.WriteFile(suite.fs, "./test/a", []byte("stale"), 0644))
+	bucket := NewBucket(BucketOptions{Path: "./test/a", Fs: suite.fs, SpillBytes: 10})
+	suite.NoError(bucket.Open())
+	suite.False(suite.exists("./test/a"))
+}
+
+func (suite *SpillTestSuite) TestEncoded() {
+	bucket := NewBucket(BucketOptions{
+		Path:        "./test/a",
+		Fs:          suite.fs,
+		Checksum:    true,
+		Compression: "gzip",
+		Encryption:  KeyRing{Current: "a", Keys: map[string][]byte{"a": make([]byte, 32)}},
+		WriteBuffer: 16,
+		SpillBytes:  32,
+	})
+	suite.NoError(bucket.Open())
+	for n := 0; n < 10; n++ {
+		suite.NoError(bucket.Write([]byte(fmt.Sprintf("record %d", n))))
+	}
+	suite.True(suite.exists("./test/a"))
+	suite.NoError(bucket.Close())
+
+	for n := 0; n < 10; n++ {
+		record, err := bucket.NextRecord()
+		suite.NoError(err)
+		suite.Equal(fmt.Sprintf("record %d", n), string(record))
+	}
+	problems, err := bucket.Verify()
+	suite.NoError(err)
+	suite.Empty(problems)
+}
+
+func (suite *SpillTestSuite) TestSegmented() {
+	bucket := NewBucket(BucketOptions{Path: "./test/a", Fs: suite.fs, Framed: true, MaxSegmentWrites: 2, SpillBytes: 10})
+	suite.NoError(bucket.Open())
+	suite.NoError(bucket.Write([]byte("one")))
+	suite.Empty(bucket.Segments())
+	suite.NoError(bucket.Write([]byte("two")))
+	suite.Len(bucket.Segments(), 1)
+
+	suite.NoError(bucket.Write([]byte("three")))
+	suite.NoError(bucket.Write([]byte("four")))
+	suite.NoError(bucket.Write([]byte("five")))
+	suite.Len(bucket.Segments(), 3)
+	suite.NoError(bucket.Close())
+
+	for _, expected := range []string{"one", "two", "three", "four", "five"} {
+		record, err := bucket.NextRecord()
+		suite.NoError(err)
+		suite.Equal(expected, string(record))
+	}
+}
+
+func (suite *SpillTestSuite) TestReaders() {
+	bucket := NewBucket(BucketOptions{Path: "./test/a", Fs: suite.fs, Framed: true, SpillBytes: 100})
+	suite.NoError(bucket.Open())
+	suite.NoError(bucket.Write([]byte("hello")))
+	suite.NoError(bucket.Close())
+
+	reader, err := bucket.NewReader()
+	suite.NoError(err)
+	data, err := ioutil.ReadAll(reader)
+	suite.NoError(err)
+	suite.Len(data, 9)
+	suite.NoError(reader.Close())
+
+	p := make([]byte, 5)
+	_, err = bucket.ReadAt(p, 4)
+	suite.NoError(err)
+	suite.Equal("hello", string(p))
+
+	problems, err := bucket.Verify()
+	suite.NoError(err)
+	suite.Empty(problems)
+	suite.False(suite.exists("./test/a"))
+}
+
+func (suite *SpillTestSuite) TestFollow() {
+	bucket := NewBucket(BucketOptions{Path: "./test/a", Fs: suite.fs, SpillBytes: 100})
+	suite.NoError(bucket.Open())
+	suite.NoError(bucket.Write([]byte("hello world")))
+	suite.NoError(bucket.Close())
+
+	p := make([]byte, 6)
+	_, err := io.ReadFull(bucket, p)
+	suite.NoError(err)
+	suite.Equal("hello ", string(p))
+
+	// following needs the file, reading carries on from the same place
+	follower, err := bucket.Follow(context.Background())
+	suite.NoError(err)
+	defer follower.Close()
+	suite.True(suite.exists("./test/a"))
+
+	rest, err := ioutil.ReadAll(bucket)
+	suite.NoError(err)
+	suite.Equal("world", string(rest))
+	all, err := ioutil.ReadAll(follower)
+	suite.NoError(err)
+	suite.Equal("hello world", string(all))
+}
+
+func (suite *SpillTestSuite) TestReopen() {
+	bucket := NewBucket(BucketOptions{Path: "./test/a", Fs: suite.fs, SpillBytes: 100})
+	suite.NoError(bucket.Open())
+	suite.NoError(bucket.Write([]byte("hello ")))
+	suite.NoError(bucket.Close())
+	suite.NoError(bucket.Reopen())
+	suite.NoError(bucket.Write([]byte("world")))
+	suite.NoError(bucket.Close())
+	suite.False(suite.exists("./test/a"))
+
+	data, err := ioutil.ReadAll(bucket)
+	suite.NoError(err)
+	suite.Equal("hello world", string(data))
+}
+
+func (suite *SpillTestSuite) TestCeiling() {
+	buffer := NewBuffer(BufferOptions{Root: "./test", Fs: suite.fs, SpillBytes: 100, MaxMemoryBytes: 10})
+	suite.NoError(buffer.Write("a", []byte("aaaaaa")))
+	suite.NoError(buffer.Write("b", []byte("bbb")))
+	suite.False(suite.exists("./test/a"))
+	suite.False(suite.exists("./test/b"))
+
+	// the largest bucket goes first
+	suite.NoError(buffer.Write("c", []byte("cccc")))
+	suite.True(suite.exists("./test/a"))
+	suite.False(suite.exists("./test/b"))
+	suite.False(suite.exists("./test/c"))
+	suite.Equal(uint64(7), buffer.ceiling.total)
+
+	suite.NoError(buffer.DestroyBucket("b"))
+	suite.Equal(uint64(4), buffer.ceiling.total)
+
+	suite.NoError(buffer.Close())
+	for name, expected := range map[string]string{"a": "aaaaaa", "c": "cccc"} {
+		bucket, err := buffer.Get(name)
+		suite.NoError(err)
+		data, err := ioutil.ReadAll(bucket)
+		suite.NoError(err)
+		suite.Equal(expected, string(data))
+	}
+}
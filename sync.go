@@ -0,0 +1,142 @@
+package buffer
+
+import "time"
+
+// SyncPolicy determines how often a bucket asks the filesystem to commit its
+// file to stable storage.
+type SyncPolicy int
+
+const (
+	// SyncNone leaves it up to the operating system, which is fastest but can
+	// lose acknowledged writes if the machine loses power.
+	SyncNone SyncPolicy = iota
+	// SyncEveryWrite syncs after every single write.
+	SyncEveryWrite
+	// SyncEveryN syncs after every SyncWrites writes.
+	SyncEveryN
+	// SyncPeriodic syncs in the background every SyncInterval, as long as there
+	// have been writes since the last sync.
+	SyncPeriodic
+)
+
+type flusher interface {
+	Flush() error
+}
+
+// Sync pushes any data held by compression or encryption out to the file and
+// then commits the file to stable storage.
+func (b *Bucket) Sync() error {
+	b.Lock()
+	defer b.Unlock()
+
+	if err := b.acquire(); err != nil {
+		return b.fail("sync", err)
+	}
+
+	return b.fail("sync", b.sync())
+}
+
+func (b *Bucket) sync() error {
+	// there is nothing on disk to sync until the bucket is spilled
+	if b.memory != nil {
+		return nil
+	}
+	if b.file == nil {
+		return ErrBucketNotOpen
+	}
+
+	for _, closer := range b.closers {
+		if f, ok := closer.(flusher); ok {
+			if err := f.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := b.file.Sync(); err != nil {
+		return err
+	}
+
+	b.unsynced = 0
+	b.notify()
+
+	return nil
+}
+
+// synced is called after each write to apply the sync policy.
+func (b *Bucket) synced() error {
+	b.unsynced++
+
+	switch b.syncPolicy {
+	case SyncEveryWrite:
+		return b.sync()
+	case SyncEveryN:
+		if b.unsynced >= b.syncWrites {
+			return b.sync()
+		}
+	}
+
+	return nil
+}
+
+// background starts syncing and/or flushing periodically when those options
+// are in use, this stops as soon as the bucket is closed.
+func (b *Bucket) background() {
+	syncs := b.syncPolicy == SyncPeriodic
+	flushes := b.buffered != nil && b.flushInterval > 0
+	if !syncs && !flushes {
+		return
+	}
+
+	stop := make(chan struct{})
+	b.stop = stop
+
+	go func() {
+		var syncTicks, flushTicks <-chan time.Time
+		if syncs {
+			ticks, stop := b.ticker(b.syncInterval)
+			defer stop()
+			syncTicks = ticks
+		}
+		if flushes {
+			ticks, stop := b.ticker(b.flushInterval)
+			defer stop()
+			flushTicks = ticks
+		}
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-syncTicks:
+				b.Lock()
+				if b.open && b.file != nil && b.unsynced > 0 && b.syncErr == nil {
+					b.syncErr = b.sync()
+				}
+				b.Unlock()
+			case <-flushTicks:
+				b.Lock()
+				if b.open && b.buffered != nil && b.buffered.Buffered() > 0 && b.syncErr == nil {
+					b.syncErr = b.buffered.Flush()
+					b.notify()
+				}
+				b.Unlock()
+			}
+		}
+	}()
+}
+
+// newTicker starts a real ticker, returning its channel and how to stop it. It
+// is replaced in tests to decide when the ticker fires.
+func newTicker(d time.Duration) (<-chan time.Time, func()) {
+	ticker := time.NewTicker(d)
+	return ticker.C, ticker.Stop
+}
+
+// halt stops any background activity started for this bucket.
+func (b *Bucket) halt() {
+	if b.stop != nil {
+		close(b.stop)
+		b.stop = nil
+	}
+}
@@ -0,0 +1,160 @@
+package buffer
+
+import (
+	"errors"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/suite"
+)
+
+type SyncTestSuite struct {
+	suite.Suite
+	fs *countingFs
+}
+
+func TestSyncTestSuite(t *testing.T) {
+	suite.Run(t, new(SyncTestSuite))
+}
+
+func (suite *SyncTestSuite) SetupTest() {
+	suite.fs = &countingFs{Fs: afero.NewMemMapFs()}
+}
+
+func (suite *SyncTestSuite) TestNone() {
+	bucket := openBucket(suite.T(), suite.fs, BucketOptions{Sync: SyncNone})
+	suite.write(bucket, 10)
+	suite.NoError(bucket.Close())
+	suite.EqualValues(0, suite.fs.count())
+}
+
+func (suite *SyncTestSuite) TestEveryWrite() {
+	bucket := openBucket(suite.T(), suite.fs, BucketOptions{Sync: SyncEveryWrite})
+	suite.write(bucket, 10)
+	suite.EqualValues(10, suite.fs.count())
+	suite.NoError(bucket.Close())
+	suite.EqualValues(11, suite.fs.count())
+}
+
+func (suite *SyncTestSuite) TestEveryN() {
+	bucket := openBucket(suite.T(), suite.fs, BucketOptions{Sync: SyncEveryN, SyncWrites: 3})
+	suite.write(bucket, 10)
+	suite.EqualValues(3, suite.fs.count())
+	suite.NoError(bucket.Close())
+	suite.EqualValues(4, suite.fs.count())
+}
+
+func (suite *SyncTestSuite) TestPeriodic() {
+	bucket := NewBucket(BucketOptions{Path: "./test/a", Fs: suite.fs, Sync: SyncPeriodic})
+	ticker := newManualTicker()
+	bucket.ticker = ticker.start
+	suite.NoError(bucket.Open())
+	ticker.fire()
+	suite.EqualValues(0, suite.fs.count(), "nothing to sync without writes")
+	suite.write(bucket, 1)
+	ticker.fire()
+	suite.EqualValues(1, suite.fs.count())
+	suite.NoError(bucket.Close())
+	suite.EqualValues(2, suite.fs.count())
+	suite.Eventually(ticker.stopped, time.Second, time.Millisecond, "stops syncing once closed")
+}
+
+func (suite *SyncTestSuite) TestSync() {
+	bucket := openBucket(suite.T(), suite.fs, BucketOptions{})
+	suite.write(bucket, 1)
+	suite.NoError(bucket.Sync())
+	suite.EqualValues(1, suite.fs.count())
+}
+
+func (suite *SyncTestSuite) TestSyncFlushes() {
+	bucket := openBucket(suite.T(), suite.fs, BucketOptions{Compression: "gzip"})
+	suite.write(bucket, 1)
+	suite.EqualValues(10, bucket.DiskBytes(), "only the gzip header has been written")
+	suite.NoError(bucket.Sync())
+	suite.True(bucket.DiskBytes() > 10)
+}
+
+func (suite *SyncTestSuite) TestSyncUnopened() {
+	bucket := NewBucket(BucketOptions{Path: "./test/a", Fs: suite.fs})
+	suite.True(errors.Is(bucket.Sync(), ErrBucketNotOpen))
+}
+
+func (suite *SyncTestSuite) TestBuffer() {
+	buffer := NewBuffer(BufferOptions{Root: "./test", Fs: suite.fs, Sync: SyncEveryWrite})
+	suite.NoError(buffer.Write("1", []byte("hello world")))
+	suite.NoError(buffer.Write("2", []byte("hello world")))
+	suite.EqualValues(2, suite.fs.count())
+	suite.NoError(buffer.Sync())
+	suite.EqualValues(4, suite.fs.count())
+}
+
+func (suite *SyncTestSuite) write(bucket *Bucket, times int) {
+	for x := 0; x < times; x++ {
+		suite.NoError(bucket.Write([]byte("hello world\n")))
+	}
+}
+
+// manualTicker replaces the background tickers of a bucket or buffer, so tests
+// decide when they fire.
+type manualTicker struct {
+	ticks chan time.Time
+	stops int32
+}
+
+func newManualTicker() *manualTicker {
+	return &manualTicker{ticks: make(chan time.Time)}
+}
+
+func (t *manualTicker) start(time.Duration) (<-chan time.Time, func()) {
+	return t.ticks, func() { atomic.AddInt32(&t.stops, 1) }
+}
+
+// fire ticks and waits until that has been handled, since the next tick is
+// only received once it is.
+func (t *manualTicker) fire() {
+	t.ticks <- time.Time{}
+	t.ticks <- time.Time{}
+}
+
+func (t *manualTicker) stopped() bool {
+	return atomic.LoadInt32(&t.stops) > 0
+}
+
+// countingFs wraps another afero.Fs to count how many times files are synced.
+type countingFs struct {
+	afero.Fs
+	syncs int32
+}
+
+func (fs *countingFs) Create(name string) (afero.File, error) {
+	file, err := fs.Fs.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return &countingFile{File: file, fs: fs}, nil
+}
+
+func (fs *countingFs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	file, err := fs.Fs.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &countingFile{File: file, fs: fs}, nil
+}
+
+func (fs *countingFs) count() int32 {
+	return atomic.LoadInt32(&fs.syncs)
+}
+
+type countingFile struct {
+	afero.File
+	fs *countingFs
+}
+
+func (f *countingFile) Sync() error {
+	atomic.AddInt32(&f.fs.syncs, 1)
+	return f.File.Sync()
+}
@@ -0,0 +1,141 @@
+package buffer
+
+import (
+	"path/filepath"
+	"sort"
+)
+
+// Children lists the names found directly beneath the given prefix, which may
+// be buckets or namespaces containing further buckets. Calling this without a
+// prefix lists the top level.
+func (b *Buffer) Children(prefix ...string) []string {
+	b.RLock()
+	defer b.RUnlock()
+
+	seen := make(map[string]bool)
+	for _, bucket := range b.buckets {
+		if len(bucket.name) > len(prefix) && within(bucket.name, prefix) {
+			seen[bucket.name[len(prefix)]] = true
+		}
+	}
+
+	list := make([]string, 0, len(seen))
+	for name := range seen {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// CloseTree closes every bucket beneath the given prefix in preparation for
+// reading, leaving the rest of the buffer accepting writes.
+func (b *Buffer) CloseTree(prefix ...string) error {
+	b.Lock()
+	defer b.Unlock()
+
+	for _, bucket := range b.buckets {
+		if within(bucket.name, prefix) {
+			if err := bucket.Close(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// ResetTree removes every bucket beneath the given prefix, freeing up the
+// space they were using towards any quotas.
+func (b *Buffer) ResetTree(prefix ...string) error {
+	b.Lock()
+	defer b.Unlock()
+
+	return b.resetTree(prefix)
+}
+
+func (b *Buffer) resetTree(prefix []string) error {
+	for _, bucket := range b.buckets {
+		if within(bucket.name, prefix) {
+			if err := b.destroy(bucket); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// DestroyTree is the same as ResetTree, but also deletes the directory for the
+// prefix along with anything else left inside it.
+func (b *Buffer) DestroyTree(prefix ...string) error {
+	if len(prefix) == 0 {
+		return b.Destroy()
+	}
+
+	key, err := b.key(prefix)
+	if err != nil {
+		return err
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	if err := b.resetTree(prefix); err != nil {
+		return err
+	}
+
+	return b.fs.RemoveAll(filepath.Join(b.root, key))
+}
+
+// TreeWrites counts all the writes to buckets beneath the given prefix.
+func (b *Buffer) TreeWrites(prefix ...string) uint {
+	b.RLock()
+	defer b.RUnlock()
+
+	var count uint
+	for _, bucket := range b.buckets {
+		if within(bucket.name, prefix) {
+			count += bucket.Writes()
+		}
+	}
+	return count
+}
+
+// TreeBytes counts all the bytes written to buckets beneath the given prefix.
+func (b *Buffer) TreeBytes(prefix ...string) uint64 {
+	b.RLock()
+	defer b.RUnlock()
+
+	var count uint64
+	for _, bucket := range b.buckets {
+		if within(bucket.name, prefix) {
+			count += bucket.Bytes()
+		}
+	}
+	return count
+}
+
+// conflicts finds an existing bucket that would overlap with a new bucket at
+// the given path, since a name cannot be both a bucket and a namespace. The
+// caller must hold the lock.
+func (b *Buffer) conflicts(path []string) *Bucket {
+	for _, bucket := range b.buckets {
+		if within(bucket.name, path) || within(path, bucket.name) {
+			return bucket
+		}
+	}
+	return nil
+}
+
+// within determines whether a bucket path starts with the given prefix.
+func within(path, prefix []string) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+	for i, name := range prefix {
+		if path[i] != name {
+			return false
+		}
+	}
+	return true
+}
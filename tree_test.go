@@ -0,0 +1,152 @@
+package buffer
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/suite"
+)
+
+type TreeTestSuite struct {
+	suite.Suite
+	buffer *Buffer
+}
+
+func TestTreeTestSuite(t *testing.T) {
+	suite.Run(t, new(TreeTestSuite))
+}
+
+func (suite *TreeTestSuite) SetupTest() {
+	suite.buffer = NewBuffer(BufferOptions{
+		Root: "./test",
+		Fs:   afero.NewMemMapFs(),
+	})
+	suite.NoError(suite.buffer.WritePath([]string{"2026-10-16", "acme"}, []byte("hello")))
+	suite.NoError(suite.buffer.WritePath([]string{"2026-10-16", "globex"}, []byte("world")))
+	suite.NoError(suite.buffer.WritePath([]string{"2026-10-17", "acme"}, []byte("!")))
+	suite.NoError(suite.buffer.Write("flat", []byte("flat")))
+}
+
+func (suite *TreeTestSuite) TestWritePath() {
+	suite.assertFile("test/2026-10-16/acme", "hello")
+	suite.assertFile("test/2026-10-16/globex", "world")
+	suite.assertFile("test/2026-10-17/acme", "!")
+	suite.assertFile("test/flat", "flat")
+}
+
+func (suite *TreeTestSuite) TestWritePathEscaped() {
+	suite.NoError(suite.buffer.WritePath([]string{"a/b", ".."}, []byte("x")))
+	suite.assertFile("test/a%2Fb/%2E.", "x")
+}
+
+func (suite *TreeTestSuite) TestWritePathEmpty() {
+	suite.IsType(&InvalidNameError{}, suite.buffer.WritePath(nil, []byte("x")))
+}
+
+func (suite *TreeTestSuite) TestWritePathOverlap() {
+	err := suite.buffer.WritePath([]string{"flat", "nested"}, []byte("x"))
+	suite.IsType(&InvalidNameError{}, err)
+	err = suite.buffer.Write("2026-10-16", []byte("x"))
+	suite.IsType(&InvalidNameError{}, err)
+	suite.EqualValues(4, suite.buffer.Size())
+}
+
+func (suite *TreeTestSuite) TestGetPath() {
+	bucket, err := suite.buffer.GetPath("2026-10-16", "acme")
+	suite.NoError(err)
+	suite.EqualValues(1, bucket.Writes())
+}
+
+func (suite *TreeTestSuite) TestBuckets() {
+	suite.Equal([]string{"flat"}, suite.buffer.Buckets())
+	suite.EqualValues(4, suite.buffer.Size())
+}
+
+func (suite *TreeTestSuite) TestChildren() {
+	suite.Equal([]string{"2026-10-16", "2026-10-17", "flat"}, suite.buffer.Children())
+	suite.Equal([]string{"acme", "globex"}, suite.buffer.Children("2026-10-16"))
+	suite.Equal([]string{}, suite.buffer.Children("2026-10-16", "acme"))
+	suite.Equal([]string{}, suite.buffer.Children("missing"))
+}
+
+func (suite *TreeTestSuite) TestCloseTree() {
+	suite.NoError(suite.buffer.CloseTree("2026-10-16"))
+	suite.Error(suite.buffer.WritePath([]string{"2026-10-16", "acme"}, []byte("x")))
+	suite.NoError(suite.buffer.WritePath([]string{"2026-10-17", "acme"}, []byte("x")))
+}
+
+func (suite *TreeTestSuite) TestResetTree() {
+	suite.NoError(suite.buffer.ResetTree("2026-10-16"))
+	suite.EqualValues(2, suite.buffer.Size())
+	suite.Equal([]string{"2026-10-17", "flat"}, suite.buffer.Children())
+	suite.assertExists("test/2026-10-16/acme", false)
+	suite.assertExists("test/2026-10-17/acme", true)
+}
+
+func (suite *TreeTestSuite) TestDestroyTree() {
+	suite.NoError(suite.buffer.DestroyTree("2026-10-16"))
+	suite.EqualValues(2, suite.buffer.Size())
+	suite.assertExists("test/2026-10-16", false)
+	suite.assertExists("test/2026-10-17/acme", true)
+}
+
+func (suite *TreeTestSuite) TestTreeWrites() {
+	suite.EqualValues(2, suite.buffer.TreeWrites("2026-10-16"))
+	suite.EqualValues(1, suite.buffer.TreeWrites("2026-10-16", "acme"))
+	suite.EqualValues(0, suite.buffer.TreeWrites("missing"))
+	suite.EqualValues(4, suite.buffer.TreeWrites())
+}
+
+func (suite *TreeTestSuite) TestTreeBytes() {
+	suite.EqualValues(10, suite.buffer.TreeBytes("2026-10-16"))
+	suite.EqualValues(1, suite.buffer.TreeBytes("2026-10-17"))
+	suite.EqualValues(15, suite.buffer.TreeBytes())
+}
+
+func (suite *TreeTestSuite) TestRecover() {
+	suite.NoError(suite.buffer.Close())
+	recovered := NewBuffer(BufferOptions{
+		Root:    "./test",
+		Fs:      suite.buffer.fs,
+		Recover: true,
+	})
+	suite.NoError(recovered.Open())
+	suite.EqualValues(4, recovered.Size())
+	suite.Equal([]string{"acme", "globex"}, recovered.Children("2026-10-16"))
+	suite.EqualValues(10, recovered.TreeBytes("2026-10-16"))
+	bucket, err := recovered.GetPath("2026-10-17", "acme")
+	suite.NoError(err)
+	suite.EqualValues(1, bucket.Bytes())
+}
+
+func (suite *TreeTestSuite) TestRecoverSegmented() {
+	options := BufferOptions{
+		Root:             "./segmented",
+		Fs:               suite.buffer.fs,
+		Framed:           true,
+		MaxSegmentWrites: 1,
+	}
+	buffer := NewBuffer(options)
+	suite.NoError(buffer.WritePath([]string{"a", "b"}, []byte("1"), []byte("2")))
+	suite.NoError(buffer.WritePath([]string{"a", "b"}, []byte("3")))
+	suite.NoError(buffer.Write("c", []byte("4")))
+	suite.NoError(buffer.Close())
+	options.Recover = true
+	recovered := NewBuffer(options)
+	suite.NoError(recovered.Open())
+	suite.EqualValues(2, recovered.Size())
+	suite.Equal([]string{"a", "c"}, recovered.Children())
+	suite.EqualValues(2, recovered.TreeWrites("a", "b"))
+}
+
+func (suite *TreeTestSuite) assertFile(path string, expected string) {
+	data, err := afero.ReadFile(suite.buffer.fs, path)
+	suite.NoError(err)
+	suite.Equal(expected, string(data))
+}
+
+func (suite *TreeTestSuite) assertExists(path string, expected bool) {
+	exists, err := afero.Exists(suite.buffer.fs, path)
+	suite.NoError(err)
+	suite.Equal(expected, exists)
+}
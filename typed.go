@@ -0,0 +1,152 @@
+package buffer
+
+import (
+	"context"
+	"io"
+)
+
+// TypedBuffer wraps a Buffer so that values of a single type are written to
+// it, using a Codec to convert them. The rest of the Buffer API is available
+// as usual.
+type TypedBuffer[T any] struct {
+	*Buffer
+	codec Codec[T]
+}
+
+// NewTypedBuffer creates a new instance from the given options, which stores
+// values using the codec.
+func NewTypedBuffer[T any](o BufferOptions, codec Codec[T]) *TypedBuffer[T] {
+	return &TypedBuffer[T]{Buffer: NewBuffer(o), codec: codec}
+}
+
+// Write encodes the value and adds it to the named bucket.
+func (b *TypedBuffer[T]) Write(name string, value T) error {
+	return b.write(context.Background(), []string{name}, value)
+}
+
+// WriteContext is the same as Write, but gives up as soon as the context is
+// done. (see Buffer.WriteContext)
+func (b *TypedBuffer[T]) WriteContext(ctx context.Context, name string, value T) error {
+	return b.write(ctx, []string{name}, value)
+}
+
+// WritePath is the same as Write, but for a nested bucket. (see GetPath)
+func (b *TypedBuffer[T]) WritePath(path []string, value T) error {
+	return b.write(context.Background(), path, value)
+}
+
+func (b *TypedBuffer[T]) write(ctx context.Context, path []string, value T) error {
+	key, err := b.key(path)
+	if err != nil {
+		return err
+	}
+
+	data, err := b.codec.Encode(value)
+	if err != nil {
+		return b.fail("encode", path, key, err)
+	}
+
+	return b.Buffer.write(ctx, path, [][]byte{data})
+}
+
+// Get retrieves the named bucket, creating it if it does not exist yet.
+func (b *TypedBuffer[T]) Get(name string) (*TypedBucket[T], error) {
+	return b.GetPath(name)
+}
+
+// GetPath retrieves a nested bucket, creating it if it does not exist yet.
+func (b *TypedBuffer[T]) GetPath(path ...string) (*TypedBucket[T], error) {
+	bucket, err := b.Buffer.GetPath(path...)
+	if err != nil {
+		return nil, err
+	}
+	return NewTypedBucket(bucket, b.codec), nil
+}
+
+// TypedBucket wraps a Bucket so that values of a single type are written to
+// it, using a Codec to convert them. The rest of the Bucket API is available
+// as usual.
+type TypedBucket[T any] struct {
+	*Bucket
+	codec Codec[T]
+}
+
+// NewTypedBucket wraps the given bucket, which stores values using the codec.
+func NewTypedBucket[T any](bucket *Bucket, codec Codec[T]) *TypedBucket[T] {
+	return &TypedBucket[T]{Bucket: bucket, codec: codec}
+}
+
+// Write encodes the value and adds it to this bucket.
+func (b *TypedBucket[T]) Write(value T) error {
+	data, err := b.codec.Encode(value)
+	if err != nil {
+		return b.fail("encode", err)
+	}
+	return b.Bucket.Write(data)
+}
+
+// Values returns an iterator for the values in this bucket, which must be
+// closed first like for Read. Values are read using NextRecord when the bucket
+// is framed, otherwise the codec must be Delimited so they can be read one
+// line at a time. Since the iterator reads from the bucket itself, only use
+// one at a time and don't mix it with calls to Read or NextRecord.
+func (b *TypedBucket[T]) Values() *Iterator[T] {
+	it := &Iterator[T]{entries: newEntries(b.Bucket), codec: b.codec}
+	if d, ok := b.codec.(Delimited); !b.framed && (!ok || !d.Delimited()) {
+		it.err = b.fail("read", ErrNotFramed)
+	}
+	return it
+}
+
+// Iterator yields decoded values from a bucket, eg:
+//
+//	it := bucket.Values()
+//	for it.Next() {
+//		fmt.Println(it.Value())
+//	}
+//	if err := it.Err(); err != nil {
+//		// handle the error
+//	}
+type Iterator[T any] struct {
+	*entries
+	codec Codec[T]
+	value T
+	err   error
+}
+
+// Next advances to the next value, returning false when there are no more or
+// something went wrong. (see Err)
+func (it *Iterator[T]) Next() bool {
+	if it.err != nil {
+		return false
+	}
+
+	data, err := it.next()
+	if err != nil {
+		it.err = err
+		return false
+	}
+
+	value, err := it.codec.Decode(data)
+	if err != nil {
+		it.err = it.bucket.fail("decode", &LineError{Line: it.count, Err: err})
+		return false
+	}
+
+	it.value = value
+	return true
+}
+
+// Value retrieves the current value, after Next has returned true.
+func (it *Iterator[T]) Value() T {
+	return it.value
+}
+
+// Err retrieves the error that stopped the iterator, if any. Reaching the end
+// of the bucket is not an error.
+func (it *Iterator[T]) Err() error {
+	if it.err == io.EOF {
+		return nil
+	}
+	return it.err
+}
@@ -0,0 +1,156 @@
+package buffer
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/suite"
+)
+
+type TypedTestSuite struct {
+	suite.Suite
+	options BufferOptions
+}
+
+func TestTypedTestSuite(t *testing.T) {
+	suite.Run(t, new(TypedTestSuite))
+}
+
+func (suite *TypedTestSuite) SetupTest() {
+	suite.options = BufferOptions{
+		Root: "./test",
+		Fs:   afero.NewMemMapFs(),
+	}
+}
+
+// values reads everything from the bucket using an iterator.
+func (suite *TypedTestSuite) values(bucket *TypedBucket[codecRecord]) ([]codecRecord, error) {
+	var list []codecRecord
+	it := bucket.Values()
+	for it.Next() {
+		list = append(list, it.Value())
+	}
+	return list, it.Err()
+}
+
+func (suite *TypedTestSuite) TestCodecs() {
+	expected := []codecRecord{{ID: 1, Name: "a"}, {ID: 2, Name: "b\nc"}}
+	codecs := map[string]struct {
+		codec  Codec[codecRecord]
+		framed bool
+	}{
+		"json":        {JSONCodec[codecRecord]{}, false},
+		"json framed": {JSONCodec[codecRecord]{}, true},
+		"gob":         {GobCodec[codecRecord]{}, true},
+	}
+
+	for name, c := range codecs {
+		suite.SetupTest()
+		suite.options.Framed = c.framed
+		buffer := NewTypedBuffer(suite.options, c.codec)
+		for _, value := range expected {
+			suite.NoError(buffer.Write("a", value), name)
+		}
+		suite.NoError(buffer.Close(), name)
+
+		bucket, err := buffer.Get("a")
+		suite.NoError(err, name)
+		suite.Equal(uint(2), bucket.Writes(), name)
+		actual, err := suite.values(bucket)
+		suite.NoError(err, name)
+		suite.Equal(expected, actual, name)
+	}
+}
+
+func (suite *TypedTestSuite) TestText() {
+	buffer := NewTypedBuffer[string](suite.options, TextCodec[string]{})
+	suite.NoError(buffer.WritePath([]string{"x", "y"}, "hello"))
+	suite.NoError(buffer.WritePath([]string{"x", "y"}, ""))
+	suite.NoError(buffer.WritePath([]string{"x", "y"}, "world"))
+
+	err := buffer.WritePath([]string{"x", "y"}, "a\nb")
+	var bucketErr *BucketError
+	suite.True(errors.As(err, &bucketErr))
+	suite.Equal("encode", bucketErr.Op)
+	suite.Equal([]string{"x", "y"}, bucketErr.Name)
+	suite.NoError(buffer.Close())
+
+	contents, err := afero.ReadFile(suite.options.Fs, "./test/x/y")
+	suite.NoError(err)
+	suite.Equal("hello\n\nworld\n", string(contents))
+
+	bucket, err := buffer.GetPath("x", "y")
+	suite.NoError(err)
+	var lines []string
+	it := bucket.Values()
+	for it.Next() {
+		lines = append(lines, it.Value())
+	}
+	suite.NoError(it.Err())
+	suite.Equal([]string{"hello", "", "world"}, lines)
+	suite.False(it.Next())
+}
+
+func (suite *TypedTestSuite) TestNotFramed() {
+	buffer := NewTypedBuffer[codecRecord](suite.options, GobCodec[codecRecord]{})
+	suite.NoError(buffer.Write("a", codecRecord{ID: 1}))
+	suite.NoError(buffer.Close())
+
+	bucket, err := buffer.Get("a")
+	suite.NoError(err)
+	_, err = suite.values(bucket)
+	suite.True(errors.Is(err, ErrNotFramed))
+}
+
+// undelimited opts out of being read one line at a time.
+type undelimited struct {
+	JSONCodec[codecRecord]
+}
+
+func (undelimited) Delimited() bool {
+	return false
+}
+
+func (suite *TypedTestSuite) TestNotDelimited() {
+	buffer := NewTypedBuffer[codecRecord](suite.options, undelimited{})
+	suite.NoError(buffer.Write("a", codecRecord{ID: 1}))
+	suite.NoError(buffer.Close())
+
+	bucket, err := buffer.Get("a")
+	suite.NoError(err)
+	_, err = suite.values(bucket)
+	suite.True(errors.Is(err, ErrNotFramed))
+}
+
+func (suite *TypedTestSuite) TestDecodeError() {
+	buffer := NewBuffer(suite.options)
+	suite.NoError(buffer.Write("a", []byte("{\"ID\":1}\n")))
+	suite.NoError(buffer.Write("a", []byte("nope\n")))
+	suite.NoError(buffer.Write("a", []byte("{\"ID\":3}")))
+	suite.NoError(buffer.Close())
+
+	raw, err := buffer.Get("a")
+	suite.NoError(err)
+	bucket := NewTypedBucket[codecRecord](raw, JSONCodec[codecRecord]{})
+	actual, err := suite.values(bucket)
+	suite.Equal([]codecRecord{{ID: 1}}, actual)
+	var bucketErr *BucketError
+	suite.True(errors.As(err, &bucketErr))
+	suite.Equal("decode", bucketErr.Op)
+}
+
+func (suite *TypedTestSuite) TestBucket() {
+	bucket := NewTypedBucket[codecRecord](NewBucket(BucketOptions{
+		Path:   "./test/a",
+		Fs:     suite.options.Fs,
+		Framed: true,
+	}), GobCodec[codecRecord]{})
+	suite.NoError(bucket.Open())
+	suite.NoError(bucket.Write(codecRecord{ID: 1}))
+	suite.NoError(bucket.Close())
+
+	actual, err := suite.values(bucket)
+	suite.NoError(err)
+	suite.Equal([]codecRecord{{ID: 1}}, actual)
+}
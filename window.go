@@ -0,0 +1,115 @@
+package buffer
+
+import (
+	"context"
+	"time"
+)
+
+// defaultWindowFormat names each window bucket after the time it starts, for
+// both Window and TimePartitioner.
+const defaultWindowFormat = "20060102T150405Z"
+
+// WriteAt adds the given data to the bucket for the window of time containing
+// t. This is only available when the buffer has a Window set in its options.
+func (b *Buffer) WriteAt(t time.Time, data ...[]byte) error {
+	return b.WriteAtContext(context.Background(), t, data...)
+}
+
+// WriteAtContext is the same as WriteAt, but gives up as soon as the context is
+// done (see WriteContext).
+func (b *Buffer) WriteAtContext(ctx context.Context, t time.Time, data ...[]byte) error {
+	if b.window <= 0 {
+		return ErrNotWindowed
+	}
+
+	name := t.UTC().Truncate(b.window).Format(b.windowFormat)
+	return b.write(ctx, []string{name}, data)
+}
+
+// windowEnd determines when the window for a bucket ends, based on its name.
+// This is zero for any bucket that is not for a window.
+func (b *Buffer) windowEnd(path []string) time.Time {
+	if b.window <= 0 || len(path) != 1 {
+		return time.Time{}
+	}
+
+	start, err := time.Parse(b.windowFormat, path[0])
+	if err != nil {
+		return time.Time{}
+	}
+	return start.Add(b.window)
+}
+
+// background starts sealing windows once they have expired, this stops as soon
+// as the buffer is closed.
+func (b *Buffer) background() {
+	if b.window <= 0 || b.stop != nil {
+		return
+	}
+
+	stop := make(chan struct{})
+	b.stop = stop
+
+	go func() {
+		ticks, stopTicks := b.ticker(b.sealInterval)
+		defer stopTicks()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticks:
+				b.seal(stop)
+			}
+		}
+	}()
+}
+
+// seal closes the bucket for every window that ended more than the grace
+// period ago, then passes them to the OnSeal callback. The callback is run
+// without holding the lock, so it is free to call back into the buffer.
+func (b *Buffer) seal(stop chan struct{}) {
+	b.Lock()
+
+	// the buffer may have been closed while waiting on the lock
+	select {
+	case <-stop:
+		b.Unlock()
+		return
+	default:
+	}
+
+	now := b.now()
+	var sealed []*Bucket
+	for _, bucket := range b.buckets {
+		if bucket.window.IsZero() || now.Before(bucket.window.Add(b.windowGrace)) {
+			continue
+		}
+
+		// only try once, the error is kept for Close to report
+		bucket.window = time.Time{}
+		if err := bucket.Close(); err != nil {
+			if b.sealErr == nil {
+				b.sealErr = err
+			}
+			continue
+		}
+		sealed = append(sealed, bucket)
+	}
+
+	b.Unlock()
+
+	if b.onSeal != nil {
+		for _, bucket := range sealed {
+			b.onSeal(bucket)
+		}
+	}
+}
+
+// halt stops sealing windows in the background.
+func (b *Buffer) halt() {
+	if b.stop != nil {
+		close(b.stop)
+		b.stop = nil
+	}
+}
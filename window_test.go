@@ -0,0 +1,172 @@
+package buffer
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/suite"
+)
+
+type WindowTestSuite struct {
+	suite.Suite
+	buffer *Buffer
+	sealed chan *Bucket
+	ticker *manualTicker
+	mu     sync.Mutex
+	now    time.Time
+}
+
+func TestWindowTestSuite(t *testing.T) {
+	suite.Run(t, new(WindowTestSuite))
+}
+
+func (suite *WindowTestSuite) SetupTest() {
+	suite.sealed = make(chan *Bucket, 10)
+	suite.now = time.Date(2026, 10, 16, 12, 0, 30, 0, time.UTC)
+	suite.buffer = NewBuffer(suite.options())
+}
+
+func (suite *WindowTestSuite) TearDownTest() {
+	suite.NoError(suite.buffer.Close())
+}
+
+func (suite *WindowTestSuite) options() BufferOptions {
+	return BufferOptions{
+		Root:        "./test",
+		Fs:          afero.NewMemMapFs(),
+		Framed:      true,
+		Window:      time.Minute,
+		WindowGrace: 10 * time.Second,
+		OnSeal: func(bucket *Bucket) {
+			suite.sealed <- bucket
+		},
+	}
+}
+
+func (suite *WindowTestSuite) open(buffer *Buffer) {
+	buffer.now = func() time.Time {
+		suite.mu.Lock()
+		defer suite.mu.Unlock()
+		return suite.now
+	}
+	suite.ticker = newManualTicker()
+	buffer.ticker = suite.ticker.start
+	suite.NoError(buffer.Open())
+}
+
+func (suite *WindowTestSuite) advance(d time.Duration) {
+	suite.mu.Lock()
+	defer suite.mu.Unlock()
+	suite.now = suite.now.Add(d)
+}
+
+func (suite *WindowTestSuite) TestWriteAt() {
+	t := time.Date(2026, 10, 16, 14, 35, 10, 0, time.FixedZone("CEST", 2*60*60))
+	suite.NoError(suite.buffer.WriteAt(t, []byte("a")))
+	suite.NoError(suite.buffer.WriteAt(t.Add(20*time.Second), []byte("b")))
+	suite.NoError(suite.buffer.WriteAt(t.Add(time.Minute), []byte("c")))
+	suite.Len(suite.buffer.Buckets(), 2)
+	bucket, err := suite.buffer.Get("20261016T123500Z")
+	suite.NoError(err)
+	suite.EqualValues(2, bucket.Writes())
+	suite.Equal([]string{"20261016T123500Z"}, bucket.Name())
+	suite.Equal(time.Date(2026, 10, 16, 12, 36, 0, 0, time.UTC), bucket.window)
+}
+
+func (suite *WindowTestSuite) TestWriteAtNotWindowed() {
+	buffer := NewBuffer(BufferOptions{Root: "./test", Fs: afero.NewMemMapFs()})
+	suite.True(errors.Is(buffer.WriteAt(time.Now(), []byte("a")), ErrNotWindowed))
+}
+
+func (suite *WindowTestSuite) TestSeal() {
+	suite.open(suite.buffer)
+	suite.NoError(suite.buffer.WriteAt(suite.now, []byte("a")))
+	suite.NoError(suite.buffer.WriteAt(suite.now.Add(time.Minute), []byte("b")))
+	suite.NoError(suite.buffer.Write("other", []byte("c")))
+
+	// still within the grace period
+	suite.advance(35 * time.Second)
+	suite.assertNotSealed()
+
+	suite.advance(5 * time.Second)
+	bucket := suite.assertSealed()
+	suite.Equal([]string{"20261016T120000Z"}, bucket.Name())
+	record, err := bucket.NextRecord()
+	suite.NoError(err)
+	suite.Equal([]byte("a"), record)
+	err = suite.buffer.WriteAt(suite.now.Add(-time.Minute), []byte("late"))
+	suite.True(errors.Is(err, ErrBucketSealed))
+	suite.assertNotSealed()
+
+	suite.advance(time.Minute)
+	bucket = suite.assertSealed()
+	suite.Equal([]string{"20261016T120100Z"}, bucket.Name())
+
+	// other buckets are left alone
+	suite.advance(time.Hour)
+	suite.assertNotSealed()
+	suite.NoError(suite.buffer.Write("other", []byte("d")))
+}
+
+func (suite *WindowTestSuite) TestSealCallback() {
+	options := suite.options()
+	options.OnSeal = func(bucket *Bucket) {
+		suite.NoError(suite.buffer.DestroyBucket(bucket.Name()[0]))
+		suite.sealed <- bucket
+	}
+	suite.buffer = NewBuffer(options)
+	suite.open(suite.buffer)
+	suite.NoError(suite.buffer.WriteAt(suite.now, []byte("a")))
+	suite.advance(time.Hour)
+	suite.assertSealed()
+	suite.EqualValues(0, suite.buffer.Size())
+}
+
+func (suite *WindowTestSuite) TestClose() {
+	suite.open(suite.buffer)
+	suite.NoError(suite.buffer.WriteAt(suite.now, []byte("a")))
+	suite.NoError(suite.buffer.Close())
+	suite.Eventually(suite.ticker.stopped, time.Second, time.Millisecond)
+	suite.Empty(suite.sealed)
+}
+
+func (suite *WindowTestSuite) TestRecover() {
+	suite.NoError(suite.buffer.WriteAt(suite.now, []byte("a")))
+	suite.NoError(suite.buffer.Write("other", []byte("b")))
+	options := suite.options()
+	options.Fs = suite.buffer.fs
+	options.Recover = true
+	suite.buffer = NewBuffer(options)
+	suite.open(suite.buffer)
+	suite.advance(time.Hour)
+	bucket := suite.assertSealed()
+	suite.Equal([]string{"20261016T120000Z"}, bucket.Name())
+	suite.EqualValues(1, bucket.Writes())
+	suite.assertNotSealed()
+}
+
+// assertSealed checks for the next tick sealing exactly one bucket.
+func (suite *WindowTestSuite) assertSealed() *Bucket {
+	suite.ticker.fire()
+	select {
+	case bucket := <-suite.sealed:
+		suite.Empty(suite.sealed)
+		return bucket
+	default:
+		suite.Fail("bucket was not sealed")
+		return nil
+	}
+}
+
+// assertNotSealed checks for the next tick not sealing anything.
+func (suite *WindowTestSuite) assertNotSealed() {
+	suite.ticker.fire()
+	select {
+	case bucket := <-suite.sealed:
+		suite.Fail("unexpected bucket sealed", "%v", bucket.Name())
+	default:
+	}
+}